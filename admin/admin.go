@@ -0,0 +1,180 @@
+// Package admin provides HTTP handler for inspecting and changing ligno
+// logger tree of running application.
+//
+// GET on handler root lists all loggers, GET on logger full name (for
+// example "/db.pool") returns single logger and PUT on logger full name
+// changes its level or handler. PUT on handler root changes root logger.
+// Body of PUT request is JSON object like:
+//
+//	{"level": "DEBUG", "recursive": true, "handler": "stderr"}
+//
+// where all fields are optional. Handler is name of one of presets that
+// admin handler is created with.
+package admin // import "go.delic.rs/ligno/admin"
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.delic.rs/ligno"
+)
+
+// LoggerInfo describes state of single logger.
+type LoggerInfo struct {
+	Name           string      `json:"name"`
+	Level          ligno.Level `json:"level"`
+	EffectiveLevel ligno.Level `json:"effective_level"`
+	Propagate      bool        `json:"propagate"`
+	QueueLength    int         `json:"queue_length"`
+	Handler        string      `json:"handler"`
+}
+
+// Update is body of PUT request that changes logger.
+type Update struct {
+	// Level is new level for logger, if set.
+	Level *ligno.Level `json:"level"`
+	// Recursive is flag that indicates that level should be set to all
+	// descendants of logger too.
+	Recursive bool `json:"recursive"`
+	// Handler is name of preset handler that logger should use, if set.
+	Handler string `json:"handler"`
+}
+
+// Handler is http.Handler that exposes logger tree.
+type Handler struct {
+	presets map[string]ligno.Handler
+}
+
+// NewHandler creates admin handler. Provided presets are handlers that
+// loggers can be switched to, by their name.
+func NewHandler(presets map[string]ligno.Handler) *Handler {
+	if presets == nil {
+		presets = make(map[string]ligno.Handler)
+	}
+	return &Handler{presets: presets}
+}
+
+// ServeHTTP is implementation of http.Handler interface.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(r.URL.Path, "/")
+	switch r.Method {
+	case http.MethodGet:
+		if name == "" {
+			writeJSON(w, http.StatusOK, Loggers())
+			return
+		}
+		l, ok := Find(name)
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("logger %q not found", name))
+			return
+		}
+		writeJSON(w, http.StatusOK, Info(l))
+	case http.MethodPut:
+		l, ok := Find(name)
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("logger %q not found", name))
+			return
+		}
+		var update Update
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := h.apply(l, update); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, Info(l))
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// apply changes logger according to update.
+func (h *Handler) apply(l *ligno.Logger, update Update) error {
+	var handler ligno.Handler
+	if update.Handler != "" {
+		var ok bool
+		if handler, ok = h.presets[update.Handler]; !ok {
+			return fmt.Errorf("unknown handler preset %q", update.Handler)
+		}
+	}
+	if update.Level != nil {
+		if update.Recursive {
+			l.SetLevelRecursive(*update.Level)
+		} else {
+			l.SetLevel(*update.Level)
+		}
+	}
+	if handler != nil {
+		l.SetHandler(handler)
+	}
+	return nil
+}
+
+// Find returns logger with provided full name, without creating it.
+// Empty name is name of root logger.
+func Find(name string) (*ligno.Logger, bool) {
+	current := ligno.RootLogger()
+	if name == "" {
+		return current, true
+	}
+	for _, part := range strings.Split(name, ".") {
+		var found *ligno.Logger
+		for _, child := range current.Children() {
+			if child.Name() == part {
+				found = child
+				break
+			}
+		}
+		if found == nil {
+			return nil, false
+		}
+		current = found
+	}
+	return current, true
+}
+
+// Loggers returns information about all loggers in tree, starting with
+// root logger, in depth first order.
+func Loggers() []LoggerInfo {
+	var infos []LoggerInfo
+	var walk func(l *ligno.Logger)
+	walk = func(l *ligno.Logger) {
+		infos = append(infos, Info(l))
+		for _, child := range l.Children() {
+			walk(child)
+		}
+	}
+	walk(ligno.RootLogger())
+	return infos
+}
+
+// Info returns information about provided logger.
+func Info(l *ligno.Logger) LoggerInfo {
+	return LoggerInfo{
+		Name:           l.FullName(),
+		Level:          l.Level(),
+		EffectiveLevel: l.EffectiveLevel(),
+		Propagate:      l.Propagates(),
+		QueueLength:    l.QueueLength(),
+		Handler:        fmt.Sprintf("%T", l.Handler()),
+	}
+}
+
+// writeJSON writes provided value to response as JSON.
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	encoder.Encode(value)
+}
+
+// writeError writes error to response as JSON.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
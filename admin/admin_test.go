@@ -0,0 +1,79 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.delic.rs/ligno"
+)
+
+func TestListLoggers(t *testing.T) {
+	ligno.GetLoggerOptions("admin.list.db", ligno.LoggerOptions{Level: ligno.WARNING})
+	server := httptest.NewServer(NewHandler(nil))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var infos []LoggerInfo
+	if err := json.NewDecoder(resp.Body).Decode(&infos); err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, info := range infos {
+		if info.Name == "admin.list.db" {
+			found = true
+			if info.Level != ligno.WARNING || !info.Propagate {
+				t.Errorf("Unexpected logger info: %+v", info)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Logger admin.list.db not listed in %+v", infos)
+	}
+}
+
+func TestUpdateLogger(t *testing.T) {
+	l := ligno.GetLoggerOptions("admin.update.db", ligno.LoggerOptions{Level: ligno.ERROR})
+	pool := l.SubLogger("pool")
+	memory := ligno.MemoryHandler(ligno.SimpleFormat())
+	server := httptest.NewServer(NewHandler(map[string]ligno.Handler{"memory": memory}))
+	defer server.Close()
+
+	body := `{"level": "DEBUG", "recursive": true, "handler": "memory"}`
+	req, _ := http.NewRequest(http.MethodPut, server.URL+"/admin.update.db", strings.NewReader(body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Unexpected status: %d", resp.StatusCode)
+	}
+	if l.Level() != ligno.DEBUG || pool.Level() != ligno.DEBUG {
+		t.Errorf("Level not updated recursively: %s, %s", l.Level(), pool.Level())
+	}
+	if l.Handler() != memory {
+		t.Error("Handler not switched to preset.")
+	}
+
+	for path, status := range map[string]int{
+		"/admin.update.missing": http.StatusNotFound,
+		"/admin.update.db":      http.StatusBadRequest,
+	} {
+		req, _ := http.NewRequest(http.MethodPut, server.URL+path, strings.NewReader(`{"handler": "unknown"}`))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("Expected status %d for %s, got %d", status, path, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package ligno
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BatchHandler is implemented by handlers that can process multiple records
+// at once more efficiently than one by one, for example by writing them
+// with single system call or request. If handler of logger implements it,
+// logger passes all records waiting in its queue to HandleBatch at once.
+// Provided slice must not be retained after HandleBatch returns.
+type BatchHandler interface {
+	HandleBatch([]Record) error
+}
+
+// BatchHandlerFunc is function that implements BatchHandler interface.
+type BatchHandlerFunc func([]Record) error
+
+// HandleBatch just calls BatchHandlerFunc.
+func (bhf BatchHandlerFunc) HandleBatch(records []Record) error {
+	return bhf(records)
+}
+
+// Flusher is implemented by handlers that buffer records before writing
+// them. Logger calls Flush from Wait, once all queued records are handled,
+// so Flush must be safe to call concurrently with Handle.
+type Flusher interface {
+	Flush() error
+}
+
+const (
+	// DefaultBatchRecords is number of records in batch if it is not set
+	// in batch options.
+	DefaultBatchRecords = 100
+	// DefaultBatchDelay is max time record waits in batch if it is not set
+	// in batch options.
+	DefaultBatchDelay = time.Second
+)
+
+// maxWorkerBatch is max number of records that logger takes from its queue
+// at once when its handler implements BatchHandler.
+const maxWorkerBatch = 256
+
+// BatchOptions holds configuration of batching handler.
+type BatchOptions struct {
+	// MaxRecords is number of records after which batch is passed to inner
+	// handler. If not set, DefaultBatchRecords is used.
+	MaxRecords int
+	// MaxBytes is approximate size of records in bytes after which batch
+	// is passed to inner handler. Size of record is estimated from its
+	// message and context. If not set, size is not limited.
+	MaxBytes int
+	// MaxDelay is max time that record waits in batch before batch is
+	// passed to inner handler. If not set, DefaultBatchDelay is used.
+	MaxDelay time.Duration
+	// ErrorHandler is called when inner handler fails to process batch
+	// that is flushed because MaxDelay expired, since there is no caller
+	// to return error to. It receives first record of failed batch.
+	// If not set, errors are written to stderr, with rate limit.
+	ErrorHandler ErrorHandler
+}
+
+// BatchError is returned by batching handler when inner handler fails to
+// process batch. Batch is usually passed to inner handler while some other
+// record is handled, so error holds first record of failed batch, which
+// logger passes to its error handler instead of record it was handling.
+type BatchError struct {
+	// Record is first record of failed batch.
+	Record Record
+	// Size is number of records in failed batch.
+	Size int
+	// Err is error returned by inner handler.
+	Err error
+}
+
+// Error is implementation of error interface.
+func (be *BatchError) Error() string {
+	return fmt.Sprintf("batch of %d records failed: %v", be.Size, be.Err)
+}
+
+// Unwrap returns error returned by inner handler.
+func (be *BatchError) Unwrap() error {
+	return be.Err
+}
+
+// batchingHandler accumulates records and passes them to inner handler
+// in batches.
+type batchingHandler struct {
+	mu      sync.Mutex
+	inner   BatchHandler
+	options BatchOptions
+	batch   []Record
+	size    int
+	timer   *time.Timer
+}
+
+// BatchingHandler creates handler that accumulates records and passes them
+// to provided batch handler once there is MaxRecords of them, once their
+// size reaches MaxBytes or once MaxDelay passes since first of them arrived,
+// whatever comes first. Records are also passed when logger is waited for
+// (see Flusher) or stopped.
+func BatchingHandler(inner BatchHandler, options BatchOptions) Handler {
+	if options.MaxRecords <= 0 {
+		options.MaxRecords = DefaultBatchRecords
+	}
+	if options.MaxDelay <= 0 {
+		options.MaxDelay = DefaultBatchDelay
+	}
+	if options.ErrorHandler == nil {
+		options.ErrorHandler = defaultErrorHandler
+	}
+	return &batchingHandler{
+		inner:   inner,
+		options: options,
+		batch:   make([]Record, 0, options.MaxRecords),
+	}
+}
+
+// Handle adds record to batch. Error is returned only if batch is passed
+// to inner handler and it fails, in which case it is *BatchError.
+func (bh *batchingHandler) Handle(record Record) error {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+	return bh.add(record)
+}
+
+// HandleBatch adds all records to batch. It is implementation of
+// BatchHandler, so that logger passes records in bulk.
+func (bh *batchingHandler) HandleBatch(records []Record) error {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+	var errs MultiError
+	for _, record := range records {
+		if err := bh.add(record); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return errs
+	}
+}
+
+// add adds record to batch and flushes it if it is full. Caller must hold
+// lock.
+func (bh *batchingHandler) add(record Record) error {
+	bh.batch = append(bh.batch, record)
+	bh.size += recordSize(record)
+	if len(bh.batch) >= bh.options.MaxRecords || (bh.options.MaxBytes > 0 && bh.size >= bh.options.MaxBytes) {
+		return bh.flush()
+	}
+	if bh.timer == nil {
+		bh.timer = time.AfterFunc(bh.options.MaxDelay, bh.expire)
+	}
+	return nil
+}
+
+// flush passes current batch to inner handler. Returned error is
+// *BatchError. Caller must hold lock.
+func (bh *batchingHandler) flush() error {
+	if bh.timer != nil {
+		bh.timer.Stop()
+		bh.timer = nil
+	}
+	if len(bh.batch) == 0 {
+		return nil
+	}
+	batch := bh.batch
+	bh.batch = make([]Record, 0, bh.options.MaxRecords)
+	bh.size = 0
+	if err := bh.inner.HandleBatch(batch); err != nil {
+		return &BatchError{Record: batch[0], Size: len(batch), Err: err}
+	}
+	return nil
+}
+
+// expire flushes batch once max delay expires.
+func (bh *batchingHandler) expire() {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+	if len(bh.batch) == 0 {
+		return
+	}
+	first := bh.batch[0]
+	if err := bh.flush(); err != nil {
+		bh.options.ErrorHandler(err, first)
+	}
+}
+
+// Flush passes current batch to inner handler and flushes inner handler,
+// if it implements Flusher.
+func (bh *batchingHandler) Flush() error {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+	if err := bh.flush(); err != nil {
+		return err
+	}
+	if flusher, ok := bh.inner.(Flusher); ok {
+		return flusher.Flush()
+	}
+	return nil
+}
+
+// Close passes remaining records to inner handler and closes it, if it
+// implements HandlerCloser.
+func (bh *batchingHandler) Close() {
+	bh.closeNested(make(map[Handler]bool))
+}
+
+// closeNested is implementation of nestedCloser interface.
+func (bh *batchingHandler) closeNested(closed map[Handler]bool) {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+	if len(bh.batch) > 0 {
+		first := bh.batch[0]
+		if err := bh.flush(); err != nil {
+			bh.options.ErrorHandler(err, first)
+		}
+	}
+	if inner, ok := bh.inner.(Handler); ok {
+		closeHandlersIn([]Handler{inner}, closed)
+	} else if handlerCloser, ok := bh.inner.(HandlerCloser); ok {
+		handlerCloser.Close()
+	}
+}
+
+// wrapped is implementation of nestedCloser interface.
+func (bh *batchingHandler) wrapped() []Handler {
+	if inner, ok := bh.inner.(Handler); ok {
+		return []Handler{inner}
+	}
+	return nil
+}
+
+// recordSize returns approximate size of record in bytes.
+func recordSize(record Record) int {
+	size := len(record.Message) + len(record.LoggerName)
+	for key, value := range record.Context {
+		size += len(key) + len(formatValue(value))
+	}
+	return size
+}
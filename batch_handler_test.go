@@ -0,0 +1,148 @@
+package ligno
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchRecorder is batch handler that remembers sizes of batches it got.
+type batchRecorder struct {
+	mu      sync.Mutex
+	sizes   []int
+	records int
+	// release, if set, blocks first batch until it is closed
+	release chan struct{}
+}
+
+func (br *batchRecorder) Handle(record Record) error {
+	return br.HandleBatch([]Record{record})
+}
+
+func (br *batchRecorder) HandleBatch(records []Record) error {
+	br.mu.Lock()
+	first := len(br.sizes) == 0
+	br.mu.Unlock()
+	if first && br.release != nil {
+		<-br.release
+	}
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	br.sizes = append(br.sizes, len(records))
+	br.records += len(records)
+	return nil
+}
+
+func (br *batchRecorder) snapshot() ([]int, int) {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	return append([]int(nil), br.sizes...), br.records
+}
+
+func TestBatchingHandlerMaxRecords(t *testing.T) {
+	inner := new(batchRecorder)
+	l := GetLoggerOptions("batch."+randString(), LoggerOptions{
+		Handler:            BatchingHandler(inner, BatchOptions{MaxRecords: 3, MaxDelay: time.Hour}),
+		PreventPropagation: true,
+	})
+	for i := 0; i < 7; i++ {
+		l.Info("message")
+	}
+	l.Wait()
+	sizes, records := inner.snapshot()
+	if records != 7 {
+		t.Fatalf("Expected 7 records to be flushed on wait, got %d", records)
+	}
+	for _, size := range sizes {
+		if size > 3 {
+			t.Errorf("Expected batches of at most 3 records, got %v", sizes)
+		}
+	}
+	l.StopAndWait()
+}
+
+func TestBatchingHandlerMaxBytes(t *testing.T) {
+	inner := new(batchRecorder)
+	h := BatchingHandler(inner, BatchOptions{MaxBytes: 10, MaxDelay: time.Hour})
+	h.Handle(Record{Message: "12345"})
+	if _, records := inner.snapshot(); records != 0 {
+		t.Fatalf("Expected record to be kept in batch, got %d flushed", records)
+	}
+	h.Handle(Record{Message: "67890"})
+	if sizes, _ := inner.snapshot(); len(sizes) != 1 || sizes[0] != 2 {
+		t.Errorf("Expected single batch of 2 records, got %v", sizes)
+	}
+	h.(HandlerCloser).Close()
+}
+
+func TestBatchingHandlerMaxDelay(t *testing.T) {
+	inner := new(batchRecorder)
+	h := BatchingHandler(inner, BatchOptions{MaxDelay: 10 * time.Millisecond})
+	h.Handle(Record{Message: "message"})
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if _, records := inner.snapshot(); records == 1 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Error("Expected batch to be flushed after max delay.")
+}
+
+func TestLoggerDrainsBatches(t *testing.T) {
+	inner := &batchRecorder{release: make(chan struct{})}
+	l := GetLoggerOptions("batch."+randString(), LoggerOptions{
+		Handler:            inner,
+		PreventPropagation: true,
+	})
+	for i := 0; i < 10; i++ {
+		l.Info("message")
+	}
+	close(inner.release)
+	l.Wait()
+	sizes, records := inner.snapshot()
+	if records != 10 {
+		t.Fatalf("Expected 10 records, got %d", records)
+	}
+	if len(sizes) == 10 {
+		t.Errorf("Expected queued records to be passed in batches, got %v", sizes)
+	}
+	if handled := l.Stats().Handled; handled != 10 {
+		t.Errorf("Expected 10 handled records, got %d", handled)
+	}
+	l.StopAndWait()
+}
+
+func TestBatchingHandlerErrorRecord(t *testing.T) {
+	failure := errors.New("failure")
+	inner := BatchHandlerFunc(func([]Record) error { return failure })
+	h := BatchingHandler(inner, BatchOptions{MaxRecords: 2, MaxDelay: time.Hour})
+	defer h.(HandlerCloser).Close()
+	h.Handle(Record{Message: "first"})
+	err := h.Handle(Record{Message: "second"})
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || !errors.Is(err, failure) {
+		t.Fatalf("Expected BatchError, got %v", err)
+	}
+	if batchErr.Record.Message != "first" || batchErr.Size != 2 {
+		t.Errorf("Expected error for batch of 2 starting with first record, got %+v", batchErr)
+	}
+}
+
+func TestLoggerReportsFailedBatchRecord(t *testing.T) {
+	reported := make(chan Record, 1)
+	l := GetLoggerOptions("batch."+randString(), LoggerOptions{
+		Handler: HandlerFunc(func(Record) error {
+			return &BatchError{Record: Record{Message: "earlier"}, Size: 1, Err: errors.New("failure")}
+		}),
+		ErrorHandler:       func(_ error, record Record) { reported <- record },
+		PreventPropagation: true,
+	})
+	l.Info("current")
+	l.Wait()
+	if record := <-reported; record.Message != "earlier" {
+		t.Errorf("Expected error to be reported for earlier record, got %q", record.Message)
+	}
+	l.StopAndWait()
+}
@@ -85,6 +85,12 @@ func main() {
 		logFunc:   func() { ligno.Info("Ligno message") },
 		afterFunc: func() { ligno.WaitAll() },
 	})
+	nested := ligno.GetLogger("benchmark.nested.logger")
+	results = append(results, &Measurement{
+		name:      "Ligno-nested",
+		logFunc:   func() { nested.Info("Ligno message") },
+		afterFunc: func() { ligno.WaitAll() },
+	})
 	results = append(results, &Measurement{
 		name:    "Log15",
 		logFunc: func() { log15.Info("Log15 message") },
@@ -0,0 +1,146 @@
+package ligno
+
+import (
+	"context"
+	"sync"
+)
+
+// loggerContextKey is key under which logger is stored in context.Context.
+type loggerContextKey struct{}
+
+// NewContext returns copy of provided context that carries provided logger.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, l)
+}
+
+// FromContext returns logger stored in provided context by NewContext.
+// If context does not carry logger, root logger is returned.
+func FromContext(ctx context.Context) *Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(loggerContextKey{}).(*Logger); ok && l != nil {
+			return l
+		}
+	}
+	return rootLogger
+}
+
+// contextKeys holds context.Context keys whose values are added to
+// records logged with *Context methods, with names under which they
+// are added.
+var contextKeys = struct {
+	sync.RWMutex
+	names map[interface{}]string
+}{names: make(map[interface{}]string)}
+
+// RegisterContextKey registers key of context.Context values that should be
+// added to every record logged with *Context methods (like InfoContext).
+// Value is added to record context under provided name. Example:
+//
+//	type requestIDKey struct{}
+//	ligno.RegisterContextKey(requestIDKey{}, "request_id")
+//	ctx = context.WithValue(ctx, requestIDKey{}, "abc")
+//	l.InfoContext(ctx, "Request handled") // record has request_id=abc
+func RegisterContextKey(key interface{}, name string) {
+	contextKeys.Lock()
+	defer contextKeys.Unlock()
+	contextKeys.names[key] = name
+}
+
+// UnregisterContextKey removes key registered with RegisterContextKey.
+func UnregisterContextKey(key interface{}) {
+	contextKeys.Lock()
+	defer contextKeys.Unlock()
+	delete(contextKeys.names, key)
+}
+
+// addContextValues adds values of all registered keys found in provided
+// context to record context. Values already present in record context
+// are not overwritten.
+func addContextValues(ctx context.Context, data Ctx) Ctx {
+	if ctx == nil {
+		return data
+	}
+	contextKeys.RLock()
+	defer contextKeys.RUnlock()
+	for key, name := range contextKeys.names {
+		if _, ok := data[name]; ok {
+			continue
+		}
+		if value := ctx.Value(key); value != nil {
+			data[name] = value
+		}
+	}
+	return data
+}
+
+// With returns logger that adds provided key-value pairs (with same
+// semantics as in Log method) to context of every record it logs.
+// Returned logger is lightweight: it has no queues or goroutines of its
+// own and shares level, handler and queues with this logger, so it is
+// suitable for creating per request loggers. It does not need to be
+// stopped and it is not registered as child of this logger.
+func (l *Logger) With(pairs ...interface{}) *Logger {
+	return l.WithCtx(pairsToCtx(pairs))
+}
+
+// WithCtx returns logger that adds provided context to every record it
+// logs. See With for details.
+func (l *Logger) WithCtx(ctx Ctx) *Logger {
+	// context is merged once here, so that records logged with derived
+	// logger need only one merge. Context of base logger is added to
+	// records when base logger processes them.
+	var inherited Ctx
+	if l.base != nil {
+		inherited = l.context.own
+	}
+	base := l.core()
+	derived := &Logger{
+		name:     base.name,
+		fullName: base.fullName,
+		base:     base,
+	}
+	derived.context.own = inherited.merge(ctx)
+	return derived
+}
+
+// LogContext creates record with provided level, message and key-value
+// pairs (same as Log) and adds values of registered keys (see
+// RegisterContextKey) from provided context to it.
+func (l *Logger) LogContext(ctx context.Context, calldepth int, level Level, message string, pairs ...interface{}) {
+	// if level is not sufficient, do not proceed to avoid unneeded allocations
+	if !l.IsEnabledFor(level) {
+		l.core().stats.filtered.inc(level)
+		return
+	}
+	l.LogCtx(calldepth+1, level, message, addContextValues(ctx, pairsToCtx(pairs)))
+}
+
+// DebugContext logs message in DEBUG level with values from provided context.
+// Additional parameters have same semantics as in Log method.
+func (l *Logger) DebugContext(ctx context.Context, message string, pairs ...interface{}) {
+	l.LogContext(ctx, 2, DEBUG, message, pairs...)
+}
+
+// InfoContext logs message in INFO level with values from provided context.
+// Additional parameters have same semantics as in Log method.
+func (l *Logger) InfoContext(ctx context.Context, message string, pairs ...interface{}) {
+	l.LogContext(ctx, 2, INFO, message, pairs...)
+}
+
+// WarningContext logs message in WARNING level with values from provided
+// context. Additional parameters have same semantics as in Log method.
+func (l *Logger) WarningContext(ctx context.Context, message string, pairs ...interface{}) {
+	l.LogContext(ctx, 2, WARNING, message, pairs...)
+}
+
+// ErrorContext logs message in ERROR level with values from provided context.
+// Additional parameters have same semantics as in Log method.
+func (l *Logger) ErrorContext(ctx context.Context, message string, pairs ...interface{}) {
+	l.LogContext(ctx, 2, ERROR, message, pairs...)
+}
+
+// CriticalContext logs message in CRITICAL level with values from provided
+// context. Additional parameters have same semantics as in Log method.
+func (l *Logger) CriticalContext(ctx context.Context, message string, pairs ...interface{}) {
+	l.LogContext(ctx, 2, CRITICAL, message, pairs...)
+}
@@ -0,0 +1,198 @@
+package ligno
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type requestIDKey struct{}
+
+type userIDKey struct{}
+
+// contextFormat formats record as sorted key=value pairs of its context.
+func contextFormat() Formatter {
+	return FormatterFunc(func(record Record) []byte {
+		pairs := make([]string, 0, len(record.Context))
+		for k, v := range record.Context {
+			pairs = append(pairs, fmt.Sprintf("%s=%v", k, v))
+		}
+		sort.Strings(pairs)
+		return []byte(record.Message + " " + strings.Join(pairs, " "))
+	})
+}
+
+func TestFromContext(t *testing.T) {
+	if l := FromContext(context.Background()); l != rootLogger {
+		t.Errorf("Expected root logger for empty context, got %s", l.FullName())
+	}
+	l := GetLoggerOptions("context."+randString(), LoggerOptions{Handler: NullHandler()})
+	ctx := NewContext(context.Background(), l)
+	if got := FromContext(ctx); got != l {
+		t.Errorf("Expected logger %s from context, got %s", l.FullName(), got.FullName())
+	}
+	l.StopAndWait()
+}
+
+func TestLogContext(t *testing.T) {
+	RegisterContextKey(requestIDKey{}, "request_id")
+	RegisterContextKey(userIDKey{}, "user_id")
+	defer UnregisterContextKey(requestIDKey{})
+	defer UnregisterContextKey(userIDKey{})
+
+	memory := MemoryHandler(contextFormat())
+	l := GetLoggerOptions("context."+randString(), LoggerOptions{
+		Handler:            memory,
+		PreventPropagation: true,
+	})
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "abc")
+	ctx = context.WithValue(ctx, userIDKey{}, 42)
+	ctx = NewContext(ctx, l)
+
+	l.InfoContext(ctx, "method", "foo", "bar")
+	InfoContext(ctx, "package", "user_id", 7)
+	l.DebugContext(context.Background(), "no values")
+	l.Wait()
+
+	expected := []string{
+		"method foo=bar request_id=abc user_id=42",
+		"package request_id=abc user_id=7",
+		"no values ",
+	}
+	messages := memory.Messages()
+	if len(messages) != len(expected) {
+		t.Fatalf("Expected %d messages, got %v", len(expected), messages)
+	}
+	for i := range expected {
+		if messages[i] != expected[i] {
+			t.Errorf("Expected message %q, got %q", expected[i], messages[i])
+		}
+	}
+	l.StopAndWait()
+}
+
+func TestWith(t *testing.T) {
+	memory := MemoryHandler(contextFormat())
+	l := GetLoggerOptions("context."+randString(), LoggerOptions{
+		Context:            Ctx{"service": "api"},
+		Handler:            memory,
+		PreventPropagation: true,
+	})
+	derived := l.With("request_id", "abc")
+	if derived.FullName() != l.FullName() {
+		t.Errorf("Expected derived logger name %s, got %s", l.FullName(), derived.FullName())
+	}
+	derived.Info("handled", "status", 200)
+	derived.StopAndWait()
+	l.Wait()
+
+	expected := "handled request_id=abc service=api status=200"
+	if messages := memory.Messages(); len(messages) != 1 || messages[0] != expected {
+		t.Errorf("Expected message %q, got %v", expected, messages)
+	}
+	l.StopAndWait()
+}
+
+func TestWithIsLightweight(t *testing.T) {
+	memory := MemoryHandler(contextFormat())
+	l := GetLoggerOptions("context."+randString(), LoggerOptions{
+		Handler:            memory,
+		PreventPropagation: true,
+	})
+	goroutines := runtime.NumGoroutine()
+	derived := l.With("a", 1).With("b", 2).WithCtx(Ctx{"a": 3})
+	if n := runtime.NumGoroutine(); n != goroutines {
+		t.Errorf("Expected no new goroutines, got %d more", n-goroutines)
+	}
+	if len(l.Children()) != 0 {
+		t.Errorf("Expected derived loggers not to be registered as children, got %d", len(l.Children()))
+	}
+	derived.Info("first")
+	derived.StopAndWait()
+	if !l.IsRunning() {
+		t.Fatal("Expected stopping derived logger not to stop its base logger.")
+	}
+	l.Info("second")
+	l.Wait()
+
+	expected := []string{"first a=3 b=2", "second "}
+	messages := memory.Messages()
+	if len(messages) != len(expected) {
+		t.Fatalf("Expected %d messages, got %v", len(expected), messages)
+	}
+	for i := range expected {
+		if messages[i] != expected[i] {
+			t.Errorf("Expected message %q, got %q", expected[i], messages[i])
+		}
+	}
+	if logged := l.Stats().Logged[INFO]; logged != 2 {
+		t.Errorf("Expected 2 INFO records counted on base logger, got %d", logged)
+	}
+	l.StopAndWait()
+}
+
+func TestDerivedLoggerContext(t *testing.T) {
+	l := GetLoggerOptions("with."+randString(), LoggerOptions{
+		Context:            Ctx{"a": 1, "b": 1},
+		Handler:            NullHandler(),
+		PreventPropagation: true,
+	})
+	derived := l.With("b", 2).With("c", 3)
+	expected := Ctx{"a": 1, "b": 2, "c": 3}
+	if ctx := derived.Context(); !reflect.DeepEqual(ctx, expected) {
+		t.Errorf("Expected context %v, got %v", expected, ctx)
+	}
+	if ctx := l.Context(); !reflect.DeepEqual(ctx, Ctx{"a": 1, "b": 1}) {
+		t.Errorf("Expected base context to be unchanged, got %v", ctx)
+	}
+	l.StopAndWait()
+}
+
+func TestContextInheritance(t *testing.T) {
+	memory := MemoryHandler(contextFormat())
+	root := GetLoggerOptions("inherit."+randString(), LoggerOptions{
+		Context:            Ctx{"app": "api", "level": "root"},
+		Handler:            NullHandler(),
+		PreventPropagation: true,
+	})
+	child := root.SubLoggerOptions("child", LoggerOptions{
+		Context: Ctx{"level": "child"},
+		Handler: NullHandler(),
+	})
+	grandchild := child.SubLoggerOptions("grandchild", LoggerOptions{
+		Context: Ctx{"component": "db"},
+		Handler: memory,
+	})
+
+	grandchild.Info("first")
+	grandchild.Wait()
+	root.AddContext(Ctx{"version": "1.2.3"})
+	grandchild.Info("second")
+	grandchild.Wait()
+	child.SetContext(Ctx{"replaced": true})
+	grandchild.With("request", 1).Info("third")
+	grandchild.Wait()
+
+	expected := []string{
+		"first app=api component=db level=child",
+		"second app=api component=db level=child version=1.2.3",
+		"third app=api component=db level=root replaced=true request=1 version=1.2.3",
+	}
+	messages := memory.Messages()
+	if len(messages) != len(expected) {
+		t.Fatalf("Expected %d messages, got %v", len(expected), messages)
+	}
+	for i := range expected {
+		if messages[i] != expected[i] {
+			t.Errorf("Expected message %q, got %q", expected[i], messages[i])
+		}
+	}
+	if ctx := grandchild.Context(); len(ctx) != 5 {
+		t.Errorf("Expected merged context with 5 keys, got %v", ctx)
+	}
+	root.StopAndWait()
+}
@@ -1,6 +1,7 @@
 package ligno
 
 import (
+	"context"
 	"fmt"
 	"os"
 )
@@ -78,6 +79,36 @@ func CriticalCtx(message string, ctx Ctx) {
 	rootLogger.LogCtx(2, CRITICAL, message, ctx)
 }
 
+// DebugContext logs message in DEBUG level with logger and values from
+// provided context. Additional parameters have same semantics as in Log method.
+func DebugContext(ctx context.Context, event string, pairs ...interface{}) {
+	FromContext(ctx).LogContext(ctx, 2, DEBUG, event, pairs...)
+}
+
+// InfoContext logs message in INFO level with logger and values from
+// provided context. Additional parameters have same semantics as in Log method.
+func InfoContext(ctx context.Context, event string, pairs ...interface{}) {
+	FromContext(ctx).LogContext(ctx, 2, INFO, event, pairs...)
+}
+
+// WarningContext logs message in WARNING level with logger and values from
+// provided context. Additional parameters have same semantics as in Log method.
+func WarningContext(ctx context.Context, event string, pairs ...interface{}) {
+	FromContext(ctx).LogContext(ctx, 2, WARNING, event, pairs...)
+}
+
+// ErrorContext logs message in ERROR level with logger and values from
+// provided context. Additional parameters have same semantics as in Log method.
+func ErrorContext(ctx context.Context, event string, pairs ...interface{}) {
+	FromContext(ctx).LogContext(ctx, 2, ERROR, event, pairs...)
+}
+
+// CriticalContext logs message in CRITICAL level with logger and values from
+// provided context. Additional parameters have same semantics as in Log method.
+func CriticalContext(ctx context.Context, event string, pairs ...interface{}) {
+	FromContext(ctx).LogContext(ctx, 2, CRITICAL, event, pairs...)
+}
+
 // Printf formats message according to stdlib rules and logs it in INFO level.
 func Printf(format string, v ...interface{}) {
 	rootLogger.Log(2, INFO, fmt.Sprintf(format, v...))
@@ -0,0 +1,64 @@
+package ligno
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrorHandler is function that is called when handler fails to process
+// record. It receives error returned by handler and record that was
+// being processed.
+type ErrorHandler func(error, Record)
+
+// defaultErrorHandler is used by all loggers that do not have error handler
+// set. It writes errors to stderr, but not more then 10 per second, so that
+// broken handler does not flood stderr.
+var defaultErrorHandler = newRateLimitedErrorHandler(os.Stderr, 10, time.Second)
+
+// rateLimitedErrorHandler writes errors to provided writer, but not more
+// then limit errors per interval. Number of suppressed errors is reported
+// with first error written after interval expires.
+type rateLimitedErrorHandler struct {
+	mu         sync.Mutex
+	out        io.Writer
+	limit      int
+	interval   time.Duration
+	start      time.Time
+	written    int
+	suppressed int
+}
+
+// newRateLimitedErrorHandler creates error handler that writes at most limit
+// errors per interval to provided writer.
+func newRateLimitedErrorHandler(out io.Writer, limit int, interval time.Duration) ErrorHandler {
+	h := &rateLimitedErrorHandler{
+		out:      out,
+		limit:    limit,
+		interval: interval,
+	}
+	return h.handle
+}
+
+// handle writes error to output, if limit allows it.
+func (h *rateLimitedErrorHandler) handle(err error, record Record) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	if now.Sub(h.start) >= h.interval {
+		if h.suppressed > 0 {
+			fmt.Fprintf(h.out, "ligno: %d handler errors suppressed\n", h.suppressed)
+		}
+		h.start = now
+		h.written = 0
+		h.suppressed = 0
+	}
+	if h.written >= h.limit {
+		h.suppressed++
+		return
+	}
+	h.written++
+	fmt.Fprintf(h.out, "ligno: unable to handle record %q: %v\n", record.Message, err)
+}
@@ -0,0 +1,21 @@
+package ligno
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimitedErrorHandler(t *testing.T) {
+	buff := new(bytes.Buffer)
+	h := newRateLimitedErrorHandler(buff, 2, time.Hour)
+	for i := 0; i < 5; i++ {
+		h(fmt.Errorf("error %d", i), Record{Message: "msg"})
+	}
+	lines := strings.Split(strings.TrimSpace(buff.String()), "\n")
+	if len(lines) != 2 {
+		t.Errorf("Expected 2 errors to be written, got %d: %q", len(lines), buff.String())
+	}
+}
@@ -0,0 +1,263 @@
+package ligno
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFluentAddress is address of Fluentd server if it is not set in
+	// fluent options.
+	DefaultFluentAddress = "127.0.0.1:24224"
+	// DefaultFluentTag is tag of records that are logged by root logger, if
+	// tag is not set in fluent options.
+	DefaultFluentTag = "ligno"
+)
+
+// FluentOptions holds configuration of fluent handler.
+type FluentOptions struct {
+	// Network is one of "tcp", "unix" and "tcp+tls". Default is "tcp".
+	Network string
+	// Address is address of server, or path of unix socket. If not set,
+	// DefaultFluentAddress is used.
+	Address string
+	// TLSConfig is configuration of TLS connection for tcp+tls network.
+	TLSConfig *tls.Config
+	// Tag is tag of all records. If not set, full name of logger that
+	// created record is used, or DefaultFluentTag for root logger.
+	Tag string
+	// Timeout is timeout for connecting, writing and waiting for ack. If
+	// not set, DefaultNetworkTimeout is used.
+	Timeout time.Duration
+	// RequireAck makes handler request ack for every message and wait for
+	// it before returning. Message is sent once more over new connection if
+	// ack does not arrive, so records are delivered at least once.
+	RequireAck bool
+}
+
+// fluentHandler sends records to Fluentd or Fluent Bit server.
+type fluentHandler struct {
+	mu      sync.Mutex
+	options FluentOptions
+	conn    net.Conn
+	reader  *bufio.Reader
+	closed  bool
+}
+
+// FluentHandler creates handler that sends records to Fluentd or Fluent Bit
+// server on provided TCP address, with default options. See
+// FluentHandlerOptions.
+func FluentHandler(address string) Handler {
+	return FluentHandlerOptions(FluentOptions{Address: address})
+}
+
+// FluentHandlerOptions creates handler that sends records using Fluent
+// Forward protocol. Every record is sent as map with level, message, logger,
+// file and line keys, if they are set, and with record context. Keys of
+// context that are same as these are overwritten. Records handled one by one
+// are sent in Forward mode, while records in batch (see BatchHandler and
+// BatchingHandler) are sent in PackedForward mode, with single message for
+// all consecutive records that have same tag.
+//
+// Connection is established when first record is handled. If sending or
+// waiting for ack fails, handler reconnects and tries once more. If that
+// fails too, error is returned and handler reconnects on next record.
+func FluentHandlerOptions(options FluentOptions) Handler {
+	if options.Network == "" {
+		options.Network = "tcp"
+	}
+	if options.Address == "" {
+		options.Address = DefaultFluentAddress
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultNetworkTimeout
+	}
+	return &fluentHandler{options: options}
+}
+
+// Handle sends record in Forward mode.
+func (fh *fluentHandler) Handle(record Record) error {
+	buff := new(bytes.Buffer)
+	e := msgpackEncoder{buff}
+	e.writeArrayHeader(3)
+	e.writeString(fh.tag(record))
+	e.writeArrayHeader(1)
+	writeFluentEntry(e, record)
+	chunk := fh.writeOption(e, 1)
+
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	return fh.send(buff.Bytes(), chunk)
+}
+
+// HandleBatch sends records in PackedForward mode, one message for every
+// run of records with same tag.
+func (fh *fluentHandler) HandleBatch(records []Record) error {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	var errs MultiError
+	for start := 0; start < len(records); {
+		tag := fh.tag(records[start])
+		entries := new(bytes.Buffer)
+		end := start
+		for ; end < len(records) && fh.tag(records[end]) == tag; end++ {
+			writeFluentEntry(msgpackEncoder{entries}, records[end])
+		}
+
+		buff := new(bytes.Buffer)
+		e := msgpackEncoder{buff}
+		e.writeArrayHeader(3)
+		e.writeString(tag)
+		e.writeBinary(entries.Bytes())
+		chunk := fh.writeOption(e, end-start)
+		if err := fh.send(buff.Bytes(), chunk); err != nil {
+			errs = append(errs, err)
+		}
+		start = end
+	}
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return errs
+	}
+}
+
+// tag returns tag of record.
+func (fh *fluentHandler) tag(record Record) string {
+	switch {
+	case fh.options.Tag != "":
+		return fh.options.Tag
+	case record.LoggerName != "":
+		return record.LoggerName
+	default:
+		return DefaultFluentTag
+	}
+}
+
+// writeFluentEntry writes record as entry, which is array of event time and
+// record map.
+func writeFluentEntry(e msgpackEncoder, record Record) {
+	data := make(map[string]interface{}, len(record.Context)+5)
+	for key, value := range record.Context {
+		data[key] = value
+	}
+	data["level"] = record.Level.String()
+	data["message"] = record.Message
+	if record.LoggerName != "" {
+		data["logger"] = record.LoggerName
+	}
+	if record.File != "" {
+		data["file"] = record.File
+		data["line"] = record.Line
+	}
+	e.writeArrayHeader(2)
+	e.writeEventTime(record.Time)
+	e.writeMap(data)
+}
+
+// writeOption writes option map of message with provided number of
+// entries. If ack is required, it returns chunk id that server has to
+// acknowledge.
+func (fh *fluentHandler) writeOption(e msgpackEncoder, size int) string {
+	if !fh.options.RequireAck {
+		e.writeMapHeader(1)
+		e.writeString("size")
+		e.writeInt(int64(size))
+		return ""
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	chunk := base64.StdEncoding.EncodeToString(id)
+	e.writeMapHeader(2)
+	e.writeString("size")
+	e.writeInt(int64(size))
+	e.writeString("chunk")
+	e.writeString(chunk)
+	return chunk
+}
+
+// send sends message to server, reconnecting once if needed. Caller must
+// hold lock.
+func (fh *fluentHandler) send(message []byte, chunk string) error {
+	if fh.closed {
+		return errHandlerClosed
+	}
+	err := fh.write(message, chunk)
+	if err != nil && fh.conn != nil {
+		// connection might have been broken by server, or ack did not
+		// arrive, so try once more with new one
+		fh.disconnect()
+		err = fh.write(message, chunk)
+	}
+	if err != nil {
+		fh.disconnect()
+	}
+	return err
+}
+
+// write connects to server if needed, writes message and waits for ack if
+// chunk is set. Caller must hold lock.
+func (fh *fluentHandler) write(message []byte, chunk string) error {
+	if fh.conn == nil {
+		conn, err := fh.dial()
+		if err != nil {
+			return err
+		}
+		fh.conn = conn
+		fh.reader = bufio.NewReader(conn)
+	}
+	fh.conn.SetWriteDeadline(time.Now().Add(fh.options.Timeout))
+	if _, err := fh.conn.Write(message); err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+
+	fh.conn.SetReadDeadline(time.Now().Add(fh.options.Timeout))
+	response, err := readMsgpack(fh.reader)
+	if err != nil {
+		return err
+	}
+	if m, ok := response.(map[string]interface{}); !ok || m["ack"] != chunk {
+		return fmt.Errorf("invalid fluent ack %v for chunk %s", response, chunk)
+	}
+	return nil
+}
+
+// dial establishes new connection with server.
+func (fh *fluentHandler) dial() (net.Conn, error) {
+	if fh.options.Network == "tcp+tls" {
+		dialer := &net.Dialer{Timeout: fh.options.Timeout}
+		return tls.DialWithDialer(dialer, "tcp", fh.options.Address, fh.options.TLSConfig)
+	}
+	return net.DialTimeout(fh.options.Network, fh.options.Address, fh.options.Timeout)
+}
+
+// disconnect closes connection to server. Caller must hold lock.
+func (fh *fluentHandler) disconnect() {
+	if fh.conn != nil {
+		fh.conn.Close()
+		fh.conn = nil
+		fh.reader = nil
+	}
+}
+
+// Close closes connection with server. Records handled after Close are not
+// sent.
+func (fh *fluentHandler) Close() {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	fh.closed = true
+	fh.disconnect()
+}
@@ -0,0 +1,192 @@
+package ligno
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// fluentServer is in-process server that receives Fluent Forward messages.
+type fluentServer struct {
+	listener net.Listener
+	messages chan []interface{}
+	// dropFirst makes server close first connection without ack
+	dropFirst bool
+}
+
+func newFluentServer(t *testing.T, dropFirst bool) *fluentServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := &fluentServer{
+		listener:  listener,
+		messages:  make(chan []interface{}, 100),
+		dropFirst: dropFirst,
+	}
+	go fs.serve()
+	return fs
+}
+
+func (fs *fluentServer) serve() {
+	for first := true; ; first = false {
+		conn, err := fs.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func(conn net.Conn, drop bool) {
+			defer conn.Close()
+			reader := bufio.NewReader(conn)
+			for {
+				value, err := readMsgpack(reader)
+				if err != nil {
+					return
+				}
+				message := value.([]interface{})
+				fs.messages <- message
+				if drop {
+					return
+				}
+				option := message[2].(map[string]interface{})
+				if chunk, ok := option["chunk"]; ok {
+					buff := new(bytes.Buffer)
+					msgpackEncoder{buff}.writeMap(map[string]interface{}{"ack": chunk})
+					conn.Write(buff.Bytes())
+				}
+			}
+		}(conn, first && fs.dropFirst)
+	}
+}
+
+func (fs *fluentServer) next(t *testing.T) []interface{} {
+	select {
+	case message := <-fs.messages:
+		return message
+	case <-time.After(5 * time.Second):
+		t.Fatal("Message not received.")
+		return nil
+	}
+}
+
+// decodeEventTime decodes EventTime extension.
+func decodeEventTime(t *testing.T, value interface{}) time.Time {
+	ext, ok := value.(msgpackExt)
+	if !ok || ext.Type != 0 || len(ext.Data) != 8 {
+		t.Fatalf("Expected EventTime, got %#v", value)
+	}
+	return time.Unix(int64(binary.BigEndian.Uint32(ext.Data[:4])), int64(binary.BigEndian.Uint32(ext.Data[4:])))
+}
+
+func TestFluentHandlerForward(t *testing.T) {
+	server := newFluentServer(t, false)
+	defer server.listener.Close()
+	h := FluentHandler(server.listener.Addr().String())
+	defer h.(HandlerCloser).Close()
+
+	name := "fluent." + randString()
+	err := h.Handle(Record{
+		Time:       time.Now(),
+		Level:      WARNING,
+		Message:    "message",
+		Context:    Ctx{"count": 3},
+		LoggerName: name,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	message := server.next(t)
+	if message[0] != name {
+		t.Errorf("Expected tag %q, got %v", name, message[0])
+	}
+	entries := message[1].([]interface{})
+	if len(entries) != 1 {
+		t.Fatalf("Expected single entry, got %v", entries)
+	}
+	entry := entries[0].([]interface{})
+	if eventTime := decodeEventTime(t, entry[0]); time.Since(eventTime) > time.Minute {
+		t.Errorf("Unexpected event time %s", eventTime)
+	}
+	data := entry[1].(map[string]interface{})
+	expected := map[string]interface{}{
+		"level":   "WARNING",
+		"message": "message",
+		"logger":  name,
+		"count":   int64(3),
+	}
+	for key, value := range expected {
+		if data[key] != value {
+			t.Errorf("Expected %s to be %v, got %v", key, value, data[key])
+		}
+	}
+	if size := message[2].(map[string]interface{})["size"]; size != int64(1) {
+		t.Errorf("Expected size 1, got %v", size)
+	}
+}
+
+func TestFluentHandlerPackedForward(t *testing.T) {
+	server := newFluentServer(t, false)
+	defer server.listener.Close()
+	h := FluentHandlerOptions(FluentOptions{
+		Address: server.listener.Addr().String(),
+		Tag:     "app",
+	})
+	defer h.(HandlerCloser).Close()
+
+	now := time.Now()
+	err := h.(BatchHandler).HandleBatch([]Record{
+		{Time: now, Level: INFO, Message: "first", LoggerName: "a"},
+		{Time: now, Level: ERROR, Message: "second", LoggerName: "b", File: "file.go", Line: 7},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	message := server.next(t)
+	if message[0] != "app" {
+		t.Errorf("Expected tag app, got %v", message[0])
+	}
+	reader := bufio.NewReader(bytes.NewReader(message[1].([]byte)))
+	var data []map[string]interface{}
+	for {
+		entry, err := readMsgpack(reader)
+		if err != nil {
+			break
+		}
+		data = append(data, entry.([]interface{})[1].(map[string]interface{}))
+	}
+	if len(data) != 2 || data[0]["message"] != "first" || data[1]["message"] != "second" {
+		t.Fatalf("Unexpected entries: %v", data)
+	}
+	if data[1]["file"] != "file.go" || data[1]["line"] != int64(7) {
+		t.Errorf("Expected file and line, got %v", data[1])
+	}
+	if size := message[2].(map[string]interface{})["size"]; size != int64(2) {
+		t.Errorf("Expected size 2, got %v", size)
+	}
+}
+
+func TestFluentHandlerAck(t *testing.T) {
+	server := newFluentServer(t, true)
+	defer server.listener.Close()
+	h := FluentHandlerOptions(FluentOptions{
+		Address:    server.listener.Addr().String(),
+		Timeout:    time.Second,
+		RequireAck: true,
+	})
+	defer h.(HandlerCloser).Close()
+
+	if err := h.Handle(Record{Time: time.Now(), Message: "message"}); err != nil {
+		t.Fatalf("Expected message to be resent after missing ack, got %v", err)
+	}
+	first, second := server.next(t), server.next(t)
+	chunk := first[2].(map[string]interface{})["chunk"]
+	if chunk == nil || second[2].(map[string]interface{})["chunk"] != chunk {
+		t.Errorf("Expected same chunk to be sent twice, got %v and %v", first[2], second[2])
+	}
+	if first[0] != DefaultFluentTag {
+		t.Errorf("Expected default tag, got %v", first[0])
+	}
+}
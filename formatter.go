@@ -8,7 +8,9 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 	"unicode"
+	"unicode/utf8"
 
 	isatty "github.com/mattn/go-isatty"
 )
@@ -37,6 +39,11 @@ func SimpleFormat() Formatter {
 		defer buffPool.Put(buff)
 		buff.WriteString(record.Time.Format(DefaultTimeFormat))
 		buff.WriteRune(' ')
+		if record.LoggerName != "" {
+			buff.WriteRune('[')
+			buff.WriteString(record.LoggerName)
+			buff.WriteString("] ")
+		}
 		buff.WriteString(record.Message)
 		buff.WriteRune(' ')
 		if record.File != "" && record.Line > 0 {
@@ -76,6 +83,11 @@ func ThemedTerminalFormat(theme Theme) Formatter {
 		buff.Write(bytes.Repeat([]byte(" "), padSpaces))
 		buff.WriteRune(' ')
 
+		if record.LoggerName != "" {
+			buff.WriteRune('[')
+			buff.WriteString(record.LoggerName)
+			buff.WriteString("] ")
+		}
 		buff.WriteString(record.Message)
 
 		ctx := record.Context
@@ -114,6 +126,32 @@ func ThemedTerminalFormat(theme Theme) Formatter {
 	})
 }
 
+// AbbreviateLoggerName shortens every part of dot-separated logger name
+// to at most maxLength characters, for example, with maxLength 4
+// "a.b.service" becomes "a.b.serv".
+func AbbreviateLoggerName(name string, maxLength int) string {
+	if maxLength <= 0 {
+		return name
+	}
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		if utf8.RuneCountInString(part) > maxLength {
+			parts[i] = string([]rune(part)[:maxLength])
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// AbbreviatedLoggerFormat wraps provided formatter so that every part of
+// logger name is shortened to at most maxLength characters before record
+// is formatted. See AbbreviateLoggerName.
+func AbbreviatedLoggerFormat(maxLength int, formatter Formatter) Formatter {
+	return FormatterFunc(func(record Record) []byte {
+		record.LoggerName = AbbreviateLoggerName(record.LoggerName, maxLength)
+		return formatter.Format(record)
+	})
+}
+
 // Needs quote determines if provided rune is such that word that contains this
 // rune needs to be quoted.
 func needsQuote(r rune) bool {
@@ -121,14 +159,125 @@ func needsQuote(r rune) bool {
 		!unicode.IsPrint(r)
 }
 
+// LogfmtFormat returns formatter that produces records in logfmt format.
+// Each record is single line with time, level, msg and logger keys
+// followed by context keys in sorted order. Values are quoted only if
+// needed, which makes output easy to parse by tools that understand logfmt.
+func LogfmtFormat() Formatter {
+	return FormatterFunc(func(record Record) []byte {
+		buff := buffPool.Get()
+		defer buffPool.Put(buff)
+
+		buff.WriteString("time=")
+		buff.WriteString(record.Time.Format(time.RFC3339Nano))
+		buff.WriteString(" level=")
+		writeLogfmtValue(buff, record.Level.String())
+		buff.WriteString(" msg=")
+		writeLogfmtValue(buff, record.Message)
+		if record.LoggerName != "" {
+			buff.WriteString(" logger=")
+			writeLogfmtValue(buff, record.LoggerName)
+		}
+
+		ctx := record.Context
+		keys := make([]string, 0, len(ctx))
+		for k := range ctx {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			buff.WriteRune(' ')
+			writeLogfmtKey(buff, k)
+			buff.WriteRune('=')
+			writeLogfmtValue(buff, formatValue(ctx[k]))
+		}
+		buff.WriteRune('\n')
+		return buffPool.bytes(buff)
+	})
+}
+
+// writeLogfmtKey writes key to buffer, replacing all characters that are
+// not allowed in logfmt keys with underscore.
+func writeLogfmtKey(buff *bytes.Buffer, key string) {
+	if key == "" {
+		buff.WriteRune('_')
+		return
+	}
+	for _, r := range key {
+		if needsQuote(r) {
+			r = '_'
+		}
+		buff.WriteRune(r)
+	}
+}
+
+// writeLogfmtValue writes value to buffer, quoting and escaping it only
+// if it is needed.
+func writeLogfmtValue(buff *bytes.Buffer, value string) {
+	if value == "" || strings.IndexFunc(value, needsQuote) >= 0 {
+		buff.WriteString(strconv.Quote(value))
+		return
+	}
+	buff.WriteString(value)
+}
+
+// formatValue returns string representation of context value. Numbers and
+// booleans are formatted same way as in Go source, times are formatted
+// as RFC3339 and errors and stringers are formatted by their methods.
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v)
+	case int8:
+		return strconv.FormatInt(int64(v), 10)
+	case int16:
+		return strconv.FormatInt(int64(v), 10)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprintf("%+v", v)
+	}
+}
+
 // JSONFormat is simple formatter that only marshals log record to json.
 func JSONFormat(pretty bool) Formatter {
 	return FormatterFunc(func(record Record) []byte {
 		// since errors are not JSON serializable, make sure that all errors
-		// are converted to strings
+		// are converted to strings. New context is created, since original
+		// is shared with caller and other handlers.
+		ctx := make(Ctx, len(record.Context))
 		for k, v := range record.Context {
-			record.Context[k] = fmt.Sprintf("%+v", v)
+			ctx[k] = fmt.Sprintf("%+v", v)
 		}
+		record.Context = ctx
 
 		// serialize
 		var marshaled []byte
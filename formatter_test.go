@@ -0,0 +1,198 @@
+package ligno
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogfmtFormat(t *testing.T) {
+	recordTime := time.Date(2016, 1, 7, 1, 6, 10, 0, time.UTC)
+	record := Record{
+		Time:    recordTime,
+		Level:   WARNING,
+		Message: "something happened",
+		Context: Ctx{
+			"int":     42,
+			"float":   1.5,
+			"bool":    true,
+			"str":     "plain",
+			"quoted":  "needs \"quotes\"",
+			"err":     errors.New("bad thing"),
+			"time":    recordTime,
+			"a key":   "",
+			"newline": "a\nb",
+		},
+		LoggerName: "logfmt.test",
+	}
+	expected := `time=2016-01-07T01:06:10Z level=WARNING msg="something happened" logger=logfmt.test ` +
+		`a_key="" bool=true err="bad thing" float=1.5 int=42 newline="a\nb" quoted="needs \"quotes\"" ` +
+		`str=plain time=2016-01-07T01:06:10Z` + "\n"
+	got := string(LogfmtFormat().Format(record))
+	if got != expected {
+		t.Errorf("Unexpected logfmt output.\nexpected: %s\ngot:      %s", expected, got)
+	}
+}
+
+func TestJSONFormatOptions(t *testing.T) {
+	record := Record{
+		Time:    time.Date(2016, 1, 7, 1, 6, 10, 0, time.UTC),
+		Level:   INFO,
+		Message: "event \"quoted\"\n",
+		Context: Ctx{
+			"int":   42,
+			"bool":  false,
+			"err":   errors.New("bad thing"),
+			"list":  []int{1, 2},
+			"nil":   nil,
+			"chan":  make(chan int),
+			"level": "shadowed",
+		},
+	}
+	ctx := record.Context
+
+	nested := string(JSONFormatOptions(JSONOptions{}).Format(record))
+	expected := `{"time":"2016-01-07T01:06:10Z","level":"INFO","message":"event \"quoted\"\n",` +
+		`"context":{"bool":false,"chan":"` + fmt.Sprintf("%+v", ctx["chan"]) + `","err":"bad thing",` +
+		`"int":42,"level":"shadowed","list":[1,2],"nil":null}}` + "\n"
+	if nested != expected {
+		t.Errorf("Unexpected JSON output.\nexpected: %s\ngot:      %s", expected, nested)
+	}
+
+	flat := JSONFormatOptions(JSONOptions{
+		TimeKey:        "ts",
+		MessageKey:     "msg",
+		FlattenContext: true,
+		TimeLayout:     time.RFC822,
+	}).Format(record)
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(flat, &decoded); err != nil {
+		t.Fatalf("Invalid JSON %s: %v", flat, err)
+	}
+	for key, value := range map[string]interface{}{
+		"ts":     "07 Jan 16 01:06 UTC",
+		"level":  "INFO",
+		"_level": "shadowed",
+		"msg":    "event \"quoted\"\n",
+		"int":    float64(42),
+		"bool":   false,
+		"err":    "bad thing",
+	} {
+		if decoded[key] != value {
+			t.Errorf("Expected %s to be %#v, got %#v", key, value, decoded[key])
+		}
+	}
+	if _, ok := ctx["int"].(int); !ok {
+		t.Error("Formatter modified record context.")
+	}
+}
+
+func TestJSONFormatFlattenCollision(t *testing.T) {
+	record := Record{
+		Level:   INFO,
+		Context: Ctx{"level": "shadowed", "_level": "own", "__level": "other"},
+	}
+	flat := JSONFormatOptions(JSONOptions{FlattenContext: true}).Format(record)
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(flat, &decoded); err != nil {
+		t.Fatalf("Invalid JSON %s: %v", flat, err)
+	}
+	for key, value := range map[string]interface{}{
+		"level":    "INFO",
+		"_level":   "own",
+		"__level":  "other",
+		"___level": "shadowed",
+	} {
+		if decoded[key] != value {
+			t.Errorf("Expected %s to be %#v, got %#v", key, value, decoded[key])
+		}
+	}
+}
+
+func TestJSONFormatDoesNotModifyContext(t *testing.T) {
+	ctx := Ctx{"int": 42}
+	JSONFormat(false).Format(Record{Context: ctx})
+	if _, ok := ctx["int"].(int); !ok {
+		t.Error("Formatter modified record context.")
+	}
+}
+
+func TestTemplateFormat(t *testing.T) {
+	record := Record{
+		Time:       time.Date(2016, 1, 7, 1, 6, 10, 0, time.UTC),
+		Level:      INFO,
+		Message:    "event",
+		Context:    Ctx{"user_id": 42, "b": "x y"},
+		LoggerName: "template.test",
+		File:       "main.go",
+		Line:       12,
+	}
+	for pattern, expected := range map[string]string{
+		"{time:2006-01-02T15:04:05} {level:<8}|{logger} {file}:{line} {message} {ctx}": "2016-01-07T01:06:10 INFO    |template.test main.go:12 event b=\"x y\" user_id=42\n",
+		"[{level:>8}] [{level:^8}] {ctx.user_id} {ctx.missing}{{}}":                    "[    INFO] [  INFO  ] 42 {}\n",
+	} {
+		got := string(TemplateFormat(pattern).Format(record))
+		if got != expected {
+			t.Errorf("Unexpected output for pattern %q.\nexpected: %q\ngot:      %q", pattern, expected, got)
+		}
+	}
+}
+
+func TestTemplateFormatInvalid(t *testing.T) {
+	for _, pattern := range []string{
+		"{unknown}",
+		"{level",
+		"level}",
+		"{level:<x}",
+	} {
+		if _, err := CompileTemplateFormat(pattern, nil); err == nil {
+			t.Errorf("Expected error for pattern %q.", pattern)
+		}
+	}
+}
+
+func TestFormattersLoggerName(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		formatter Formatter
+		// named is expected in output of record from named logger, and
+		// root in output of record from root logger, which must not
+		// contain omitted.
+		named, root, omitted string
+	}{
+		{"SimpleFormat", SimpleFormat(), " [db.pool] message ", " message ", "["},
+		{"ThemedTerminalFormat", ThemedTerminalFormat(NoColorTheme), " [db.pool] message\n", " message\n", "["},
+		{"JSONFormat", JSONFormat(false), `"logger":"db.pool"`, `"message":"message"`, `"logger"`},
+	} {
+		record := Record{Level: INFO, Message: "message", LoggerName: "db.pool"}
+		if got := string(tc.formatter.Format(record)); !strings.Contains(got, tc.named) {
+			t.Errorf("%s: expected %q in %q", tc.name, tc.named, got)
+		}
+		record.LoggerName = ""
+		got := string(tc.formatter.Format(record))
+		if !strings.Contains(got, tc.root) || strings.Contains(got, tc.omitted) {
+			t.Errorf("%s: expected %q without logger name for root logger, got %q", tc.name, tc.root, got)
+		}
+	}
+}
+
+func TestAbbreviateLoggerName(t *testing.T) {
+	for name, expected := range map[string]string{
+		"":                "",
+		"a.b.service":     "a.b.serv",
+		"database.pool":   "data.pool",
+		"short":           "shor",
+		"ünïcödé.service": "ünïc.serv",
+	} {
+		if got := AbbreviateLoggerName(name, 4); got != expected {
+			t.Errorf("Expected %q to be abbreviated to %q, got %q", name, expected, got)
+		}
+	}
+	got := string(AbbreviatedLoggerFormat(4, TemplateFormat("{logger}")).Format(Record{LoggerName: "a.b.service"}))
+	if got != "a.b.serv\n" {
+		t.Errorf("Unexpected abbreviated output: %q", got)
+	}
+}
@@ -1,10 +1,16 @@
 package ligno
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
 	"io"
 	"log/syslog"
 	"os"
+	"reflect"
+	"strings"
 	"sync"
+	"time"
 )
 
 // Handler processes log records and writes them to appropriate destination.
@@ -36,6 +42,110 @@ func StreamHandler(out io.Writer, formatter Formatter) Handler {
 	})
 }
 
+// DefaultFlushLevel is level of records that make buffered stream handler
+// flush its buffer right away, if level is not provided.
+const DefaultFlushLevel = ERROR
+
+// bufferedStreamHandler writes records to buffer that is flushed to
+// underlying writer.
+type bufferedStreamHandler struct {
+	mu         sync.Mutex
+	out        *bufio.Writer
+	formatter  Formatter
+	flushLevel Level
+	stop       chan struct{}
+	closed     bool
+}
+
+// BufferedStreamHandler writes records to provided io.Writer through buffer
+// of provided size. Buffer is flushed when it is full, every flushInterval
+// (if it is positive), when record with level DefaultFlushLevel or above is
+// written, when logger is waited for (see Flusher) and when handler is
+// closed.
+func BufferedStreamHandler(out io.Writer, formatter Formatter, size int, flushInterval time.Duration) Handler {
+	return BufferedStreamHandlerLevel(out, formatter, size, flushInterval, DefaultFlushLevel)
+}
+
+// BufferedStreamHandlerLevel is BufferedStreamHandler that flushes buffer
+// right away when record with provided level or above is written.
+func BufferedStreamHandlerLevel(out io.Writer, formatter Formatter, size int, flushInterval time.Duration, flushLevel Level) Handler {
+	bh := &bufferedStreamHandler{
+		out:        bufio.NewWriterSize(out, size),
+		formatter:  formatter,
+		flushLevel: flushLevel,
+		stop:       make(chan struct{}),
+	}
+	if flushInterval > 0 {
+		go bh.flushPeriodically(flushInterval)
+	}
+	return bh
+}
+
+// Handle writes record to buffer.
+func (bh *bufferedStreamHandler) Handle(record Record) error {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+	if _, err := bh.out.Write(bh.formatter.Format(record)); err != nil {
+		return err
+	}
+	if record.Level >= bh.flushLevel {
+		return bh.out.Flush()
+	}
+	return nil
+}
+
+// HandleBatch writes all records to buffer, flushing it at most once.
+func (bh *bufferedStreamHandler) HandleBatch(records []Record) error {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+	flush := false
+	for _, record := range records {
+		if _, err := bh.out.Write(bh.formatter.Format(record)); err != nil {
+			return err
+		}
+		flush = flush || record.Level >= bh.flushLevel
+	}
+	if flush {
+		return bh.out.Flush()
+	}
+	return nil
+}
+
+// Flush writes buffered data to underlying writer.
+func (bh *bufferedStreamHandler) Flush() error {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+	return bh.out.Flush()
+}
+
+// flushPeriodically flushes buffer on every tick until handler is closed.
+// Errors are not reported here, since buffered writer keeps them and
+// returns them from next Handle.
+func (bh *bufferedStreamHandler) flushPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			bh.Flush()
+		case <-bh.stop:
+			return
+		}
+	}
+}
+
+// Close flushes buffer and stops periodic flushing.
+func (bh *bufferedStreamHandler) Close() {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+	if bh.closed {
+		return
+	}
+	bh.closed = true
+	close(bh.stop)
+	bh.out.Flush()
+}
+
 // Predicate is function that returns true if record should be logged, false otherwise.
 type Predicate func(Record) bool
 
@@ -59,24 +169,172 @@ func FilterLevelHandler(level Level, handler Handler) Handler {
 	return FilterHandler(levelPredicate, handler)
 }
 
+// HandlerError is error returned by one of handlers combined by combining
+// handler. It holds information about which handler failed.
+type HandlerError struct {
+	// Index is position of failed handler in list of combined handlers.
+	Index int
+	// Handler is handler that failed.
+	Handler Handler
+	// Err is error that handler returned.
+	Err error
+}
+
+// Error is implementation of error interface.
+func (he *HandlerError) Error() string {
+	return fmt.Sprintf("handler %d (%T): %v", he.Index, he.Handler, he.Err)
+}
+
+// Unwrap returns original error returned by handler.
+func (he *HandlerError) Unwrap() error {
+	return he.Err
+}
+
+// MultiError is list of errors returned by combining handlers when more
+// then one of combined handlers fails.
+type MultiError []error
+
+// Error is implementation of error interface. It joins messages of all errors.
+func (me MultiError) Error() string {
+	msgs := make([]string, 0, len(me))
+	for _, err := range me {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns all errors contained in this error.
+func (me MultiError) Unwrap() []error {
+	return me
+}
+
+// combineErrors creates error that holds all non nil errors from provided
+// list, where each error is returned by handler on same position in handlers
+// list. If there are no errors, nil is returned.
+func combineErrors(handlers []Handler, errs []error) error {
+	var me MultiError
+	for i, err := range errs {
+		if err != nil {
+			me = append(me, &HandlerError{Index: i, Handler: handlers[i], Err: err})
+		}
+	}
+	if len(me) == 0 {
+		return nil
+	}
+	return me
+}
+
 // combiningHandler combines multiple other handlers
 type combiningHandler struct {
 	Handlers []Handler
 }
 
 // Handle processes record by passing it to all internal handler of this handler.
+// If some of handlers fail, returned error is MultiError containing
+// HandlerError for each of them.
 func (ch *combiningHandler) Handle(record Record) error {
-	var err error
-	for _, h := range ch.Handlers {
-		err = h.Handle(record)
+	var errs []error
+	for i, h := range ch.Handlers {
+		if err := h.Handle(record); err != nil {
+			if errs == nil {
+				errs = make([]error, len(ch.Handlers))
+			}
+			errs[i] = err
+		}
 	}
-	return err
+	if errs == nil {
+		return nil
+	}
+	return combineErrors(ch.Handlers, errs)
 }
 
 // Close closes all internal handlers if they implement HandlerCloser interface.
+// Handler that is combined multiple times is closed only once.
 func (ch *combiningHandler) Close() {
-	for _, h := range ch.Handlers {
-		if handlerCloser, ok := h.(HandlerCloser); ok {
+	closeHandlersOnce(ch.Handlers)
+}
+
+// closeNested is implementation of nestedCloser interface.
+func (ch *combiningHandler) closeNested(closed map[Handler]bool) {
+	closeHandlersIn(ch.Handlers, closed)
+}
+
+// wrapped is implementation of nestedCloser interface.
+func (ch *combiningHandler) wrapped() []Handler {
+	return ch.Handlers
+}
+
+// Flush flushes all internal handlers that implement Flusher interface.
+func (ch *combiningHandler) Flush() error {
+	return flushHandlers(ch.Handlers)
+}
+
+// flushHandlers flushes all provided handlers that implement Flusher.
+// Errors are reported same way as in CombiningHandler.
+func flushHandlers(handlers []Handler) error {
+	var errs []error
+	for i, h := range handlers {
+		if flusher, ok := h.(Flusher); ok {
+			if err := flusher.Flush(); err != nil {
+				if errs == nil {
+					errs = make([]error, len(handlers))
+				}
+				errs[i] = err
+			}
+		}
+	}
+	if errs == nil {
+		return nil
+	}
+	return combineErrors(handlers, errs)
+}
+
+// nestedCloser is implemented by handlers that wrap other handlers, so that
+// handler that is wrapped by multiple of them, or that is also used on its
+// own, is closed only once.
+type nestedCloser interface {
+	// closeNested closes handler like Close does, but closes only wrapped
+	// handlers that are not in closed set, adding them to it.
+	closeNested(closed map[Handler]bool)
+	// wrapped returns handlers wrapped by this one.
+	wrapped() []Handler
+}
+
+// markHandlersIn adds provided handlers, and handlers wrapped by them, to
+// provided set, so that closeHandlersIn does not close them.
+func markHandlersIn(handlers []Handler, set map[Handler]bool) {
+	for _, h := range handlers {
+		if h == nil || !reflect.ValueOf(h).Comparable() || set[h] {
+			continue
+		}
+		set[h] = true
+		if nested, ok := h.(nestedCloser); ok {
+			markHandlersIn(nested.wrapped(), set)
+		}
+	}
+}
+
+// closeHandlersOnce closes all provided handlers, and handlers wrapped by
+// them, that implement HandlerCloser, where handler that is provided or
+// wrapped multiple times is closed only once.
+func closeHandlersOnce(handlers []Handler) {
+	closeHandlersIn(handlers, make(map[Handler]bool))
+}
+
+// closeHandlersIn closes provided handlers that are not in closed set and
+// adds them to it. Handlers that can not be used as map keys, like structs
+// that hold functions, are closed without checking the set.
+func closeHandlersIn(handlers []Handler, closed map[Handler]bool) {
+	for _, h := range handlers {
+		if h != nil && reflect.ValueOf(h).Comparable() {
+			if closed[h] {
+				continue
+			}
+			closed[h] = true
+		}
+		if nested, ok := h.(nestedCloser); ok {
+			nested.closeNested(closed)
+		} else if handlerCloser, ok := h.(HandlerCloser); ok {
 			handlerCloser.Close()
 		}
 	}
@@ -90,7 +348,181 @@ func CombiningHandler(handlers ...Handler) Handler {
 	}
 }
 
+// errHandlerClosed is returned by handlers that can not process records
+// after they have been closed.
+var errHandlerClosed = errors.New("handler is closed")
+
+// defaultParallelQueueSize is number of records that can wait for each
+// handler combined by parallel combining handler, if queue size is not set.
+const defaultParallelQueueSize = 1024
+
+// parallelJob is record that needs to be processed by single handler, or
+// marker that is closed once all records queued before it are processed,
+// if done is set.
+type parallelJob struct {
+	record Record
+	done   chan struct{}
+}
+
+// parallelChild is handler combined by parallel combining handler, with
+// its own queue of records and errors that it returned.
+type parallelChild struct {
+	handler Handler
+	jobs    chan parallelJob
+	mu      sync.Mutex
+	errs    []error
+}
+
+// parallelCombiningHandler passes records to multiple handlers concurrently.
+type parallelCombiningHandler struct {
+	handlers []Handler
+	children []*parallelChild
+	workers  sync.WaitGroup
+	mu       sync.RWMutex
+	closed   bool
+}
+
+// ParallelCombiningHandler creates and returns handler that passes records
+// to all provided handlers concurrently. Every handler has its own worker
+// and queue that holds at most provided number of records (if queueSize is
+// not positive, 1024 is used), so slow handler does not delay other ones
+// until its queue is full, when Handle blocks until there is room in it.
+//
+// Handle returns as soon as record is queued for all handlers, so errors
+// are reported asynchronously: every call to Handle or Flush returns errors
+// that handlers returned since previous call, same way as in
+// CombiningHandler. Flush waits for all queued records to be processed.
+func ParallelCombiningHandler(queueSize int, handlers ...Handler) Handler {
+	if queueSize <= 0 {
+		queueSize = defaultParallelQueueSize
+	}
+	ph := &parallelCombiningHandler{
+		handlers: handlers,
+		children: make([]*parallelChild, len(handlers)),
+	}
+	ph.workers.Add(len(handlers))
+	for i, h := range handlers {
+		ph.children[i] = &parallelChild{
+			handler: h,
+			jobs:    make(chan parallelJob, queueSize),
+		}
+		go ph.work(ph.children[i])
+	}
+	return ph
+}
+
+// work processes jobs of single handler until handler is closed.
+func (ph *parallelCombiningHandler) work(child *parallelChild) {
+	defer ph.workers.Done()
+	for job := range child.jobs {
+		if job.done != nil {
+			close(job.done)
+			continue
+		}
+		if err := child.handler.Handle(job.record); err != nil {
+			child.mu.Lock()
+			child.errs = append(child.errs, err)
+			child.mu.Unlock()
+		}
+	}
+}
+
+// takeErrors returns errors that handlers returned since it was last
+// called, combined same way as in CombiningHandler. Multiple errors of
+// single handler are combined in MultiError.
+func (ph *parallelCombiningHandler) takeErrors() error {
+	errs := make([]error, len(ph.children))
+	for i, child := range ph.children {
+		child.mu.Lock()
+		switch len(child.errs) {
+		case 0:
+		case 1:
+			errs[i] = child.errs[0]
+		default:
+			errs[i] = MultiError(child.errs)
+		}
+		child.errs = nil
+		child.mu.Unlock()
+	}
+	return combineErrors(ph.handlers, errs)
+}
+
+// Handle queues record for all handlers. It returns errors of previously
+// queued records, see ParallelCombiningHandler.
+func (ph *parallelCombiningHandler) Handle(record Record) error {
+	ph.mu.RLock()
+	defer ph.mu.RUnlock()
+	if ph.closed {
+		return errHandlerClosed
+	}
+	for _, child := range ph.children {
+		child.jobs <- parallelJob{record: record}
+	}
+	return ph.takeErrors()
+}
+
+// Flush waits for all queued records to be processed and flushes all
+// internal handlers that implement Flusher interface. Errors of processed
+// records are returned together with errors of flushing.
+func (ph *parallelCombiningHandler) Flush() error {
+	ph.mu.RLock()
+	defer ph.mu.RUnlock()
+	if ph.closed {
+		return nil
+	}
+	markers := make([]chan struct{}, len(ph.children))
+	for i, child := range ph.children {
+		markers[i] = make(chan struct{})
+		child.jobs <- parallelJob{done: markers[i]}
+	}
+	for _, done := range markers {
+		<-done
+	}
+	errs := ph.takeErrors()
+	if err := flushHandlers(ph.handlers); err != nil {
+		if errs == nil {
+			return err
+		}
+		return MultiError{errs, err}
+	}
+	return errs
+}
+
+// Close processes queued records, stops workers and closes all internal
+// handlers if they implement HandlerCloser interface. Handler that is
+// combined multiple times is closed only once.
+func (ph *parallelCombiningHandler) Close() {
+	ph.closeNested(make(map[Handler]bool))
+}
+
+// closeNested is implementation of nestedCloser interface.
+func (ph *parallelCombiningHandler) closeNested(closed map[Handler]bool) {
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+	if ph.closed {
+		return
+	}
+	ph.closed = true
+	for _, child := range ph.children {
+		close(child.jobs)
+	}
+	ph.workers.Wait()
+	closeHandlersIn(ph.handlers, closed)
+}
+
+// wrapped is implementation of nestedCloser interface.
+func (ph *parallelCombiningHandler) wrapped() []Handler {
+	return ph.handlers
+}
+
 // FileHandler writes log records to file with provided name.
+// File is reopened if it is moved or deleted (for example by logrotate)
+// or when Reopen is called on returned handler (see ReopenOnSignal).
+//
+// File is opened on first record and stays open until handler is closed, so
+// handler that is no longer used should be closed. When handler is replaced
+// on logger with SetHandler, its file is closed, and opened again only if
+// handler is used after that.
 func FileHandler(fileName string, formatter Formatter) Handler {
 	return &fileHandler{
 		fileName:  fileName,
@@ -98,30 +530,148 @@ func FileHandler(fileName string, formatter Formatter) Handler {
 	}
 }
 
+// Reopener is interface implemented by handlers that write to files and
+// that can reopen them, which is needed when files are rotated externally.
+type Reopener interface {
+	Reopen() error
+}
+
+// fileCheckInterval is how often file handler checks if file it writes
+// to is still on its path.
+const fileCheckInterval = time.Second
+
 // fileHandler writes log messages to file with provided name.
 type fileHandler struct {
+	mu        sync.Mutex
 	fileName  string
 	formatter Formatter
 	f         *os.File
+	// info describes opened file and it is used to detect if file on
+	// path has been replaced.
+	info os.FileInfo
+	// lastCheck is time when it was last checked if file has been replaced.
+	lastCheck time.Time
 }
 
 // Handle writes record to file.
 func (fh *fileHandler) Handle(record Record) error {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
 	if fh.f == nil {
-		f, err := os.OpenFile(fh.fileName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
-		if err != nil {
-			panic(err)
+		if err := fh.open(); err != nil {
+			return err
 		}
-		fh.f = f
+	} else if time.Since(fh.lastCheck) >= fileCheckInterval {
+		if fh.replaced() {
+			if err := fh.reopen(); err != nil {
+				return err
+			}
+		}
+		fh.lastCheck = time.Now()
 	}
 
 	_, err := fh.f.Write(fh.formatter.Format(record))
 	return err
 }
 
+// open opens file for appending and remembers its identity.
+func (fh *fileHandler) open() error {
+	f, err := os.OpenFile(fh.fileName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	fh.f = f
+	fh.info = info
+	fh.lastCheck = time.Now()
+	fileHandlers.add(fh)
+	return nil
+}
+
+// reopen closes current file, if any, and opens file on path again.
+func (fh *fileHandler) reopen() error {
+	if fh.f != nil {
+		fh.f.Close()
+		fh.f = nil
+	}
+	return fh.open()
+}
+
+// replaced returns true if file on handler path is no longer file that
+// handler has opened, by comparing device and inode.
+func (fh *fileHandler) replaced() bool {
+	info, err := os.Stat(fh.fileName)
+	if err != nil {
+		return true
+	}
+	return !os.SameFile(info, fh.info)
+}
+
+// Reopen closes file and opens it again. Use it after file has been moved
+// by external tool, like logrotate.
+func (fh *fileHandler) Reopen() error {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	return fh.reopen()
+}
+
 // Close closes file were records are being written.
 func (fh *fileHandler) Close() {
-	fh.f.Close()
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	if fh.f != nil {
+		fh.f.Close()
+		fh.f = nil
+	}
+	fileHandlers.remove(fh)
+}
+
+// fileHandlers is registry of all file handlers that have file opened,
+// used to reopen all of them at once.
+var fileHandlers = &reopenerRegistry{
+	reopeners: make(map[Reopener]struct{}),
+}
+
+// reopenerRegistry is set of handlers that can be reopened.
+type reopenerRegistry struct {
+	sync.Mutex
+	reopeners map[Reopener]struct{}
+}
+
+func (rr *reopenerRegistry) add(r Reopener) {
+	rr.Lock()
+	defer rr.Unlock()
+	rr.reopeners[r] = struct{}{}
+}
+
+func (rr *reopenerRegistry) remove(r Reopener) {
+	rr.Lock()
+	defer rr.Unlock()
+	delete(rr.reopeners, r)
+}
+
+// ReopenFileHandlers reopens files of all file handlers that are not closed.
+// If some files could not be reopened, first error is returned, but all
+// files are attempted.
+func ReopenFileHandlers() error {
+	fileHandlers.Lock()
+	reopeners := make([]Reopener, 0, len(fileHandlers.reopeners))
+	for r := range fileHandlers.reopeners {
+		reopeners = append(reopeners, r)
+	}
+	fileHandlers.Unlock()
+
+	var firstErr error
+	for _, r := range reopeners {
+		if err := r.Reopen(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
 }
 
 // NullHandler returns handler that discards all records.
@@ -178,46 +728,60 @@ type syslogHandler struct {
 	Tag       string
 	Priority  syslog.Priority
 	writer    *syslog.Writer
+	mu        sync.Mutex
 }
 
 // SyslogHandler creates new syslog handler with provided config variables.
+// Handler uses log/syslog, so it works only with local syslog server, see
+// SyslogHandlerOptions for remote servers. Facility is taken from priority
+// and severity from record level.
+// Connection to syslog server is established when first record is handled
+// and errors are returned from Handle, so that unavailable syslog server
+// does not crash application.
 func SyslogHandler(formatter Formatter, tag string, priority syslog.Priority) Handler {
-	writer, err := syslog.New(syslog.LOG_DEBUG, tag)
-	if err != nil {
-		panic(err)
-	}
 	return &syslogHandler{
 		Formatter: formatter,
 		Tag:       tag,
 		Priority:  priority,
-		writer:    writer,
 	}
 }
 
-// Handle passes all messages to syslog server. Message priorities are
-// translated to syslog compatible priorities.
+// Handle passes all messages to syslog server. Levels are translated to
+// syslog severities by ranges, see SyslogSeverity.
 func (sh *syslogHandler) Handle(record Record) error {
+	sh.mu.Lock()
+	if sh.writer == nil {
+		writer, err := syslog.New(sh.Priority, sh.Tag)
+		if err != nil {
+			sh.mu.Unlock()
+			return err
+		}
+		sh.writer = writer
+	}
+	writer := sh.writer
+	sh.mu.Unlock()
 
 	msg := string(sh.Formatter.Format(record))
-	switch record.Level {
-	case NOTSET:
-		return sh.writer.Info(msg)
-	case DEBUG:
-		return sh.writer.Debug(msg)
-	case INFO:
-		return sh.writer.Info(msg)
-	case WARNING:
-		return sh.writer.Warning(msg)
-	case ERROR:
-		return sh.writer.Err(msg)
-	case CRITICAL:
-		return sh.writer.Crit(msg)
+	switch SyslogSeverity(record.Level) {
+	case syslog.LOG_DEBUG:
+		return writer.Debug(msg)
+	case syslog.LOG_WARNING:
+		return writer.Warning(msg)
+	case syslog.LOG_ERR:
+		return writer.Err(msg)
+	case syslog.LOG_CRIT:
+		return writer.Crit(msg)
 	default:
-		return sh.writer.Info(msg)
+		return writer.Info(msg)
 	}
 }
 
 // Close closes connection with syslog server.
 func (sh *syslogHandler) Close() {
-	sh.writer.Close()
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if sh.writer != nil {
+		sh.writer.Close()
+		sh.writer = nil
+	}
 }
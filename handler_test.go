@@ -0,0 +1,360 @@
+package ligno
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileHandlerReopen(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "app.log")
+	h := FileHandler(fileName, messageFormat())
+	defer h.(HandlerCloser).Close()
+	h.Handle(Record{Message: "before"})
+	if err := os.Rename(fileName, fileName+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReopenFileHandlers(); err != nil {
+		t.Fatal(err)
+	}
+	h.Handle(Record{Message: "after"})
+
+	content, _ := ioutil.ReadFile(fileName)
+	if string(content) != "after\n" {
+		t.Errorf("Unexpected content of reopened file: %q", content)
+	}
+	content, _ = ioutil.ReadFile(fileName + ".1")
+	if string(content) != "before\n" {
+		t.Errorf("Unexpected content of moved file: %q", content)
+	}
+}
+
+func TestFileHandlerDetectsDeletedFile(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "app.log")
+	h := FileHandler(fileName, messageFormat())
+	defer h.(HandlerCloser).Close()
+	h.Handle(Record{Message: "before"})
+	if err := os.Remove(fileName); err != nil {
+		t.Fatal(err)
+	}
+	// pretend that check interval has passed
+	h.(*fileHandler).lastCheck = time.Time{}
+	h.Handle(Record{Message: "after"})
+
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "after\n" {
+		t.Errorf("Unexpected content of recreated file: %q", content)
+	}
+}
+
+func TestFileHandlerOpenError(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "missing", "app.log")
+	h := FileHandler(fileName, messageFormat())
+	defer h.(HandlerCloser).Close()
+	if err := h.Handle(Record{Message: "msg"}); err == nil {
+		t.Error("Expected error when file can not be opened.")
+	}
+}
+
+func TestFileHandlerRegistry(t *testing.T) {
+	registered := func(h Handler) bool {
+		fileHandlers.Lock()
+		defer fileHandlers.Unlock()
+		_, ok := fileHandlers.reopeners[h.(Reopener)]
+		return ok
+	}
+	dir := t.TempDir()
+	h := FileHandler(filepath.Join(dir, "app.log"), messageFormat())
+	if registered(h) {
+		t.Error("Expected handler without opened file not to be registered.")
+	}
+	l := GetLoggerOptions(randString(), LoggerOptions{
+		Handler:            h,
+		PreventPropagation: true,
+	})
+	l.Info("message")
+	l.Wait()
+	if !registered(h) {
+		t.Error("Expected handler with opened file to be registered.")
+	}
+	l.SetHandler(NullHandler())
+	if registered(h) || h.(*fileHandler).f != nil {
+		t.Error("Expected file of replaced handler to be closed.")
+	}
+	// replaced handler can still be used, for example by other logger
+	if err := h.Handle(Record{Message: "again"}); err != nil {
+		t.Fatal(err)
+	}
+	h.(HandlerCloser).Close()
+	if registered(h) {
+		t.Error("Expected closed handler not to be registered.")
+	}
+	l.StopAndWait()
+}
+
+func failingHandler(msg string) Handler {
+	return HandlerFunc(func(record Record) error {
+		return errors.New(msg)
+	})
+}
+
+func TestCombiningHandlerErrors(t *testing.T) {
+	for _, h := range []Handler{
+		CombiningHandler(failingHandler("first"), NullHandler(), failingHandler("third")),
+		ParallelCombiningHandler(2, failingHandler("first"), NullHandler(), failingHandler("third")),
+	} {
+		err := h.Handle(Record{Message: "msg"})
+		if ph, ok := h.(*parallelCombiningHandler); ok {
+			// errors of parallel handler are reported asynchronously
+			if err != nil {
+				t.Fatalf("Expected no errors before record is processed, got %v", err)
+			}
+			err = ph.Flush()
+		}
+		me, ok := err.(MultiError)
+		if !ok {
+			t.Fatalf("Expected MultiError, got %T: %v", err, err)
+		}
+		if len(me) != 2 {
+			t.Fatalf("Expected 2 errors, got %d: %v", len(me), me)
+		}
+		if he := me[0].(*HandlerError); he.Index != 0 || he.Err.Error() != "first" {
+			t.Errorf("Unexpected first error: %v", he)
+		}
+		if he := me[1].(*HandlerError); he.Index != 2 || he.Err.Error() != "third" {
+			t.Errorf("Unexpected second error: %v", he)
+		}
+		h.(HandlerCloser).Close()
+	}
+}
+
+func TestParallelCombiningHandlerConcurrent(t *testing.T) {
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	blocking := HandlerFunc(func(record Record) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+	h := ParallelCombiningHandler(0, blocking, blocking)
+	defer h.(HandlerCloser).Close()
+	if err := h.Handle(Record{}); err != nil {
+		t.Error(err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("Handlers were not called concurrently.")
+		}
+	}
+	close(release)
+	if err := h.(Flusher).Flush(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParallelCombiningHandlerSlowHandler(t *testing.T) {
+	const count = 50
+	const delay = 10 * time.Millisecond
+	slow := HandlerFunc(func(record Record) error {
+		time.Sleep(delay)
+		return nil
+	})
+	fast := MemoryHandler(messageFormat())
+	h := ParallelCombiningHandler(count, slow, fast)
+	defer h.(HandlerCloser).Close()
+
+	start := time.Now()
+	for i := 0; i < count; i++ {
+		h.Handle(Record{Message: "msg"})
+	}
+	for len(fast.Messages()) < count && time.Since(start) < count*delay {
+		time.Sleep(time.Millisecond)
+	}
+	// slow handler needs count*delay for all records, fast one must not
+	// wait for it
+	if elapsed := time.Since(start); elapsed >= count*delay/2 {
+		t.Errorf("Expected fast handler to process %d records without waiting for slow one, took %s (got %d)", count, elapsed, len(fast.Messages()))
+	}
+	if err := h.(Flusher).Flush(); err != nil {
+		t.Error(err)
+	}
+	if elapsed := time.Since(start); elapsed < count*delay {
+		t.Errorf("Expected Flush to wait for slow handler, returned after %s", elapsed)
+	}
+}
+
+// countingCloser counts how many times it was closed.
+type countingCloser struct {
+	closed int
+}
+
+func (cc *countingCloser) Handle(record Record) error { return nil }
+func (cc *countingCloser) Close()                     { cc.closed++ }
+
+func TestRoutingHandler(t *testing.T) {
+	low := MemoryHandler(messageFormat())
+	high := MemoryHandler(messageFormat())
+	critical := MemoryHandler(messageFormat())
+	db := MemoryHandler(messageFormat())
+	records := []Record{
+		{Level: DEBUG, Message: "debug"},
+		{Level: INFO, Message: "info"},
+		{Level: WARNING, Message: "warning"},
+		{Level: CRITICAL, Message: "critical"},
+		{Level: INFO, Message: "db", LoggerName: "routing.db.pool"},
+	}
+
+	h := RoutingHandler(AllMatch,
+		LoggerPrefixRoute("routing.db", db),
+		LevelRoute(DEBUG, INFO, low),
+		LevelRoute(WARNING, NOTSET, high),
+		LevelRoute(CRITICAL, NOTSET, critical),
+	)
+	for _, r := range records {
+		h.Handle(r)
+	}
+	for _, c := range []struct {
+		handler  InspectHandler
+		expected int
+	}{{low, 3}, {high, 2}, {critical, 1}, {db, 1}} {
+		if got := len(c.handler.Messages()); got != c.expected {
+			t.Errorf("Expected %d messages, got %d: %v", c.expected, got, c.handler.Messages())
+		}
+	}
+
+	first := MemoryHandler(messageFormat())
+	rest := MemoryHandler(messageFormat())
+	h = RoutingHandler(FirstMatch,
+		LoggerPrefixRoute("routing.db", first),
+		Route{Predicate: func(Record) bool { return true }, Handler: rest},
+	)
+	for _, r := range records {
+		h.Handle(r)
+	}
+	if len(first.Messages()) != 1 || len(rest.Messages()) != 4 {
+		t.Errorf("Unexpected first match routing: %v, %v", first.Messages(), rest.Messages())
+	}
+}
+
+func TestRoutingHandlerClose(t *testing.T) {
+	shared := &countingCloser{}
+	other := &countingCloser{}
+	h := RoutingHandler(AllMatch,
+		LevelRoute(DEBUG, INFO, shared),
+		LevelRoute(WARNING, NOTSET, shared),
+		LevelRoute(ERROR, NOTSET, other),
+		LevelRoute(ERROR, NOTSET, NullHandler()),
+	)
+	h.(HandlerCloser).Close()
+	if shared.closed != 1 || other.closed != 1 {
+		t.Errorf("Expected every handler to be closed once, got %d and %d.", shared.closed, other.closed)
+	}
+}
+
+// valueCloser is handler with comparable type that holds function, so its
+// values can not be compared.
+type valueCloser struct {
+	Handler
+	cc *countingCloser
+}
+
+func (vc valueCloser) Close() { vc.cc.Close() }
+
+func TestCloseHandlersOnceUncomparable(t *testing.T) {
+	cc := &countingCloser{}
+	h := valueCloser{Handler: NullHandler(), cc: cc}
+	closeHandlersOnce([]Handler{h, CombiningHandler(h), cc})
+	// handlers that can not be compared are closed every time
+	if cc.closed != 3 {
+		t.Errorf("Expected handler to be closed 3 times, got %d.", cc.closed)
+	}
+}
+
+// syncBuffer is bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu   sync.Mutex
+	buff bytes.Buffer
+}
+
+func (sb *syncBuffer) Write(p []byte) (int, error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.buff.Write(p)
+}
+
+func (sb *syncBuffer) String() string {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.buff.String()
+}
+
+func TestBufferedStreamHandlerFlushesOnWait(t *testing.T) {
+	out := new(syncBuffer)
+	l := GetLoggerOptions("buffered."+randString(), LoggerOptions{
+		Handler:            BufferedStreamHandler(out, messageFormat(), 4096, 0),
+		PreventPropagation: true,
+	})
+	l.Info("first")
+	l.Info("second")
+	time.Sleep(10 * time.Millisecond)
+	if written := out.String(); written != "" {
+		t.Errorf("Expected records to be buffered, got %q", written)
+	}
+	l.Wait()
+	if written := out.String(); written != "first\nsecond\n" {
+		t.Errorf("Expected records to be flushed on wait, got %q", written)
+	}
+	l.StopAndWait()
+}
+
+func TestBufferedStreamHandlerFlushLevel(t *testing.T) {
+	out := new(syncBuffer)
+	h := BufferedStreamHandler(out, messageFormat(), 4096, 0)
+	h.Handle(Record{Level: INFO, Message: "info"})
+	if written := out.String(); written != "" {
+		t.Errorf("Expected INFO record to be buffered, got %q", written)
+	}
+	h.Handle(Record{Level: ERROR, Message: "error"})
+	if written := out.String(); written != "info\nerror\n" {
+		t.Errorf("Expected ERROR record to flush buffer, got %q", written)
+	}
+	h.(HandlerCloser).Close()
+}
+
+func TestBufferedStreamHandlerInterval(t *testing.T) {
+	out := new(syncBuffer)
+	h := BufferedStreamHandler(out, messageFormat(), 4096, 5*time.Millisecond)
+	defer h.(HandlerCloser).Close()
+	h.Handle(Record{Level: INFO, Message: "info"})
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if out.String() == "info\n" {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Errorf("Expected buffer to be flushed periodically, got %q", out.String())
+}
+
+func TestBufferedStreamHandlerClose(t *testing.T) {
+	out := new(syncBuffer)
+	h := BufferedStreamHandler(out, messageFormat(), 4096, time.Hour)
+	h.Handle(Record{Level: INFO, Message: "info"})
+	h.(HandlerCloser).Close()
+	h.(HandlerCloser).Close()
+	if written := out.String(); written != "info\n" {
+		t.Errorf("Expected buffer to be flushed on close, got %q", written)
+	}
+}
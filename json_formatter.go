@@ -0,0 +1,252 @@
+package ligno
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// JSONOptions is container for configuration of JSON formatter created
+// with JSONFormatOptions. Empty value is valid and produces same field
+// names as JSONFormat.
+type JSONOptions struct {
+	// TimeKey is name of field with record time. Default is "time".
+	TimeKey string
+	// LevelKey is name of field with record level. Default is "level".
+	LevelKey string
+	// MessageKey is name of field with record message. Default is "message".
+	MessageKey string
+	// LoggerKey is name of field with name of logger that created record.
+	// Default is "logger". Field is omitted for root logger.
+	LoggerKey string
+	// ContextKey is name of field under which context is nested. Default
+	// is "context". It is not used if FlattenContext is set.
+	ContextKey string
+	// FlattenContext is flag that indicates that context keys should be
+	// written as top level fields. Context keys that collide with names of
+	// other fields are prefixed with underscores, as many as needed for name
+	// not to collide with other context keys either.
+	FlattenContext bool
+	// TimeLayout is layout used for formatting record time and time values
+	// in context. Default is time.RFC3339Nano.
+	TimeLayout string
+	// Pretty is flag that indicates if output should be indented.
+	Pretty bool
+}
+
+// withDefaults returns copy of options with all empty values replaced
+// with defaults.
+func (o JSONOptions) withDefaults() JSONOptions {
+	if o.TimeKey == "" {
+		o.TimeKey = "time"
+	}
+	if o.LevelKey == "" {
+		o.LevelKey = "level"
+	}
+	if o.MessageKey == "" {
+		o.MessageKey = "message"
+	}
+	if o.LoggerKey == "" {
+		o.LoggerKey = "logger"
+	}
+	if o.ContextKey == "" {
+		o.ContextKey = "context"
+	}
+	if o.TimeLayout == "" {
+		o.TimeLayout = time.RFC3339Nano
+	}
+	return o
+}
+
+// JSONFormatOptions returns formatter that formats records as JSON objects,
+// one per line. Unlike JSONFormat, context values keep their JSON types
+// (numbers, booleans, objects...) and only errors and values that can not
+// be marshaled to JSON are converted to strings.
+func JSONFormatOptions(options JSONOptions) Formatter {
+	options = options.withDefaults()
+	reserved := map[string]bool{
+		options.TimeKey:    true,
+		options.LevelKey:   true,
+		options.MessageKey: true,
+		options.LoggerKey:  true,
+		"file":             true,
+		"line":             true,
+	}
+	return FormatterFunc(func(record Record) []byte {
+		buff := buffPool.Get()
+		defer buffPool.Put(buff)
+
+		buff.WriteRune('{')
+		writeJSONString(buff, options.TimeKey)
+		buff.WriteRune(':')
+		writeJSONString(buff, record.Time.Format(options.TimeLayout))
+		buff.WriteRune(',')
+		writeJSONString(buff, options.LevelKey)
+		buff.WriteRune(':')
+		writeJSONString(buff, record.Level.String())
+		buff.WriteRune(',')
+		writeJSONString(buff, options.MessageKey)
+		buff.WriteRune(':')
+		writeJSONString(buff, record.Message)
+		if record.LoggerName != "" {
+			buff.WriteRune(',')
+			writeJSONString(buff, options.LoggerKey)
+			buff.WriteRune(':')
+			writeJSONString(buff, record.LoggerName)
+		}
+		if record.File != "" {
+			buff.WriteString(`,"file":`)
+			writeJSONString(buff, record.File)
+			buff.WriteString(`,"line":`)
+			buff.WriteString(strconv.Itoa(record.Line))
+		}
+
+		keys := make([]string, 0, len(record.Context))
+		for k := range record.Context {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		if options.FlattenContext {
+			for _, k := range keys {
+				buff.WriteRune(',')
+				writeJSONString(buff, flatKey(k, reserved, record.Context))
+				buff.WriteRune(':')
+				writeJSONValue(buff, record.Context[k], options.TimeLayout)
+			}
+		} else {
+			buff.WriteRune(',')
+			writeJSONString(buff, options.ContextKey)
+			buff.WriteString(":{")
+			for i, k := range keys {
+				if i > 0 {
+					buff.WriteRune(',')
+				}
+				writeJSONString(buff, k)
+				buff.WriteRune(':')
+				writeJSONValue(buff, record.Context[k], options.TimeLayout)
+			}
+			buff.WriteRune('}')
+		}
+		buff.WriteRune('}')
+
+		if options.Pretty {
+			indented := buffPool.Get()
+			defer buffPool.Put(indented)
+			if err := json.Indent(indented, buff.Bytes(), "", "    "); err == nil {
+				buff = indented
+			}
+		}
+		buff.WriteRune('\n')
+		return buffPool.bytes(buff)
+	})
+}
+
+// writeJSONValue writes JSON representation of provided value to buffer.
+func writeJSONValue(buff *bytes.Buffer, value interface{}, timeLayout string) {
+	switch v := value.(type) {
+	case nil:
+		buff.WriteString("null")
+	case string:
+		writeJSONString(buff, v)
+	case bool:
+		buff.WriteString(strconv.FormatBool(v))
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		buff.WriteString(formatValue(v))
+	case float32:
+		writeJSONFloat(buff, float64(v), 32)
+	case float64:
+		writeJSONFloat(buff, v, 64)
+	case time.Time:
+		writeJSONString(buff, v.Format(timeLayout))
+	case error:
+		writeJSONString(buff, v.Error())
+	default:
+		marshaled, err := json.Marshal(v)
+		if err != nil {
+			writeJSONString(buff, fmt.Sprintf("%+v", v))
+			return
+		}
+		buff.Write(marshaled)
+	}
+}
+
+// writeJSONFloat writes float to buffer. Since NaN and infinity are not
+// valid JSON numbers, they are written as strings.
+func writeJSONFloat(buff *bytes.Buffer, f float64, bitSize int) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		writeJSONString(buff, strconv.FormatFloat(f, 'g', -1, bitSize))
+		return
+	}
+	buff.WriteString(strconv.FormatFloat(f, 'g', -1, bitSize))
+}
+
+// hexDigits is used for escaping control characters in JSON strings.
+const hexDigits = "0123456789abcdef"
+
+// flatKey returns name of top level field for context key. Key that is
+// reserved for other fields is prefixed with underscores until it collides
+// neither with reserved names nor with other context keys.
+func flatKey(key string, reserved map[string]bool, ctx Ctx) string {
+	if !reserved[key] {
+		return key
+	}
+	name := "_" + key
+	for {
+		if _, ok := ctx[name]; !ok && !reserved[name] {
+			return name
+		}
+		name = "_" + name
+	}
+}
+
+// writeJSONString writes provided string to buffer as quoted and escaped
+// JSON string.
+func writeJSONString(buff *bytes.Buffer, s string) {
+	buff.WriteByte('"')
+	start := 0
+	for i := 0; i < len(s); {
+		b := s[i]
+		if b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' {
+				i++
+				continue
+			}
+			buff.WriteString(s[start:i])
+			switch b {
+			case '"', '\\':
+				buff.WriteByte('\\')
+				buff.WriteByte(b)
+			case '\n':
+				buff.WriteString(`\n`)
+			case '\r':
+				buff.WriteString(`\r`)
+			case '\t':
+				buff.WriteString(`\t`)
+			default:
+				buff.WriteString(`\u00`)
+				buff.WriteByte(hexDigits[b>>4])
+				buff.WriteByte(hexDigits[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buff.WriteString(s[start:i])
+			buff.WriteString(`\ufffd`)
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	buff.WriteString(s[start:])
+	buff.WriteByte('"')
+}
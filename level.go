@@ -103,6 +103,18 @@ func (l *Level) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// MarshalText returns level name (implementation of encoding.TextMarshaler).
+// It is used when levels are keys of JSON objects.
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText recreates level from its name (implementation of
+// encoding.TextUnmarshaler).
+func (l *Level) UnmarshalText(b []byte) error {
+	return l.UnmarshalJSON([]byte(strconv.Quote(string(b))))
+}
+
 // Theme is definition of interface needed for colorizing log message to console.
 type Theme interface {
 	Time(msg string, args ...interface{}) string
@@ -1,9 +1,11 @@
 package ligno
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -99,6 +101,11 @@ var rootLogger = createLogger("", LoggerOptions{
 	BufferSize: 2048,
 })
 
+// RootLogger returns root logger, which is parent of all loggers.
+func RootLogger() *Logger {
+	return rootLogger
+}
+
 // WaitAll blocks until all loggers are finished with message processing.
 func WaitAll() {
 	rootLogger.Wait()
@@ -125,12 +132,55 @@ const (
 // messages and context (set of key-value pairs that will be include
 // in every log record).
 type Logger struct {
+	// dropped holds counters of records discarded because queue was full.
+	// It is kept as first field so that 64 bit atomic operations on it
+	// are properly aligned on 32 bit platforms.
+	dropped struct {
+		// total is number of records dropped during logger lifetime.
+		total uint64
+		// unreported is number of records dropped since last synthetic
+		// warning record about dropped records was emitted.
+		unreported uint64
+		// notify wakes up worker goroutine when record is dropped, so that
+		// drop is reported even if no other record is processed.
+		notify chan struct{}
+	}
+	// level is lowest level that this logger will process. If it is NOTSET,
+	// level of nearest parent that has level set is used. It is accessed
+	// atomically, so that it can be changed at runtime. It is kept right
+	// after dropped counters for same alignment reasons.
+	level uint64
+	// stats holds metrics of this logger, see Stats.
+	stats struct {
+		// handled is number of records passed to handler.
+		handled uint64
+		// handleNanos is total time in nanoseconds spent in handler.
+		handleNanos uint64
+		// handlerErrors is number of records handler failed to process.
+		handlerErrors uint64
+		// logged is number of records logged with this logger, per level.
+		logged levelCounters
+		// filtered is number of records discarded because of level.
+		filtered levelCounters
+	}
 	// name is name of this logger.
 	name string
+	// fullName is name of this logger prefixed with names of all its
+	// parents. It is computed once, when logger gets its parent.
+	fullName string
 	// Context in which logger is operating. Basically, this is set of
 	// key-value pairs that will be added to every record logged with this
 	// logger. They have lowest priority.
-	context Ctx
+	context struct {
+		sync.RWMutex
+		// own is context set for this logger.
+		own Ctx
+		// merged is own context merged with contexts of all parents. It is
+		// valid only if generation matches contextGeneration.
+		merged Ctx
+		// generation is value of contextGeneration when merged was built.
+		generation uint64
+	}
 	// handler is backed for processing records.
 	handler *replaceableHandler
 	// handlerChanged is notification mechanism to notify working goroutines
@@ -152,17 +202,21 @@ type Logger struct {
 		// preventPropagation is flag that indicates if propagation of log
 		// records to parent should be prevented.
 		preventPropagation bool
+		// sinks is cached result of sinks method. It is reset when parent
+		// of this logger is set.
+		sinks []*Logger
 	}
-	// rawMessages is channel for queueing and buffering raw messages from
-	// application which needs to be merged with context and submitted
-	// to final processing
-	rawRecords chan Record
-	// records is channel for queueing and buffering log records.
+	// records is channel for queueing and buffering log records. Records
+	// are put to it fully built, so worker only needs to pass them to
+	// handler.
 	records chan Record
 	// notifyFinished is channel of channels. When someone wants to be notified
 	// when logger processed all queued records, it sends channel that will be
 	// closed after last queued record is processed to notifyFinished.
 	notifyFinished chan chan struct{}
+	// finished is closed when worker goroutine exits, after logger is
+	// stopped and all queued records are processed.
+	finished chan struct{}
 	// toProcess is number of messages left to process in this logger.
 	toProcess int32
 	// state represents state in which logger is currently
@@ -170,11 +224,22 @@ type Logger struct {
 		sync.RWMutex
 		val loggerState
 	}
-	// level is lowest level that this logger will process
-	level Level
+	// overflowPolicy defines what happens with new records when records
+	// queue is full.
+	overflowPolicy OverflowPolicy
+	// overflowTimeout is max time to wait for room in queue when
+	// BlockWithTimeout overflow policy is used.
+	overflowTimeout time.Duration
 	// Flag that indicates that file and line of place where logging took place
 	// should be kept.
 	includeFileAndLine bool
+	// errorHandler is called when handler fails to process record.
+	errorHandler ErrorHandler
+	// base is logger that processes records of this logger, if this logger
+	// is derived with With or WithCtx. Derived logger has no queues or
+	// goroutines of its own, it only adds its context to records and passes
+	// them to base logger.
+	base *Logger
 }
 
 // LoggerOptions is container for configuration options for logger instances.
@@ -184,7 +249,9 @@ type LoggerOptions struct {
 	Context Ctx
 	// Handler for processing records.
 	Handler Handler
-	// Level is minimal level that logger will process.
+	// Level is minimal level of records that are logged with this logger.
+	// If it is NOTSET, level of parent logger is used. Records propagated
+	// from child loggers are not filtered by it.
 	Level Level
 	// BufferSize is size of buffer for records that will be process async.
 	BufferSize int
@@ -195,10 +262,20 @@ type LoggerOptions struct {
 	// should be kept. Note that this is expensive, so use with care. If this
 	// information will be shown depends on formatter.
 	IncludeFileAndLine bool
+	// OverflowPolicy defines what logger does with new records when its
+	// queue is full. Default is to block until there is room in queue.
+	OverflowPolicy OverflowPolicy
+	// OverflowTimeout is max time to wait for room in queue when
+	// BlockWithTimeout overflow policy is used. If not set,
+	// DefaultOverflowTimeout is used.
+	OverflowTimeout time.Duration
+	// ErrorHandler is called when handler returns error while processing
+	// record. If not set, errors are written to stderr, with rate limit.
+	ErrorHandler ErrorHandler
 }
 
 // createLogger creates new instance of logger, initializes all values based
-// on provided options and starts worker goroutines.
+// on provided options and starts worker goroutine.
 func createLogger(name string, options LoggerOptions) *Logger {
 	rh := new(replaceableHandler)
 	rh.Replace(options.Handler)
@@ -208,29 +285,42 @@ func createLogger(name string, options LoggerOptions) *Logger {
 	} else {
 		buffSize = 1024
 	}
+	overflowTimeout := options.OverflowTimeout
+	if overflowTimeout <= 0 {
+		overflowTimeout = DefaultOverflowTimeout
+	}
+	errorHandler := options.ErrorHandler
+	if errorHandler == nil {
+		errorHandler = defaultErrorHandler
+	}
 	l := &Logger{
 		name:               name,
-		context:            options.Context,
+		fullName:           name,
 		records:            make(chan Record, buffSize),
-		rawRecords:         make(chan Record, buffSize),
 		notifyFinished:     make(chan chan struct{}),
+		finished:           make(chan struct{}),
 		handler:            rh,
-		level:              options.Level,
+		level:              uint64(options.Level),
 		includeFileAndLine: options.IncludeFileAndLine,
+		overflowPolicy:     options.OverflowPolicy,
+		overflowTimeout:    overflowTimeout,
+		errorHandler:       errorHandler,
 	}
 	// no need to lock access to state here since we just created logger
 	// and nobody can use it anywhere else at the moment.
 	l.state.val = loggerRunning
+	l.dropped.notify = make(chan struct{}, 1)
+	l.context.own = Ctx(nil).merge(options.Context)
 	l.relationship.children = make(map[string]*Logger)
 	l.relationship.preventPropagation = options.PreventPropagation
 	go l.handle()
-	go l.processRecords()
 	return l
 }
 
 // SubLogger creates new logger that has current logger as parent with default
 // options and starts it so it is ready for message processing.
 func (l *Logger) SubLogger(name string) *Logger {
+	l = l.core()
 	newLogger := createLogger(name, LoggerOptions{})
 	l.addChild(newLogger)
 	return newLogger
@@ -239,6 +329,7 @@ func (l *Logger) SubLogger(name string) *Logger {
 // SubLoggerOptions creates new logger that has current logger as parent with
 // provided options and starts it so it is ready for message processing.
 func (l *Logger) SubLoggerOptions(name string, options LoggerOptions) *Logger {
+	l = l.core()
 	newLogger := createLogger(name, options)
 	l.addChild(newLogger)
 	return newLogger
@@ -291,14 +382,24 @@ func GetLoggerOptions(name string, options LoggerOptions) *Logger {
 }
 
 func (l *Logger) addChild(child *Logger) {
+	// set up child completely before it is visible to others through
+	// parent's children.
+	child.relationship.Lock()
+	child.relationship.parent = l
+	child.relationship.sinks = nil
+	if l.fullName != "" {
+		child.fullName = l.fullName + "." + child.name
+	}
+	child.relationship.Unlock()
+	// context cached before parent was set does not include parent's context
+	child.context.Lock()
+	child.context.merged = nil
+	child.context.Unlock()
+
 	l.relationship.Lock()
 	//	l.relationship.children = append(l.relationship.children, child)
 	l.relationship.children[child.name] = child
 	l.relationship.Unlock()
-
-	child.relationship.Lock()
-	child.relationship.parent = l
-	child.relationship.Unlock()
 }
 
 func (l *Logger) removeChild(child *Logger) {
@@ -307,19 +408,98 @@ func (l *Logger) removeChild(child *Logger) {
 	delete(l.relationship.children, child.name)
 }
 
-// SetHandler set handler to this logger to be used from now on.
+// core returns logger that processes records of this logger. This is
+// logger itself, or logger it is derived from if it is created with With.
+func (l *Logger) core() *Logger {
+	if l.base != nil {
+		return l.base
+	}
+	return l
+}
+
+// SetHandler set handler to this logger to be used from now on. If
+// replaced handler is file handler, its file is closed (see FileHandler).
 func (l *Logger) SetHandler(handler Handler) {
-	l.handler.Replace(handler)
+	old := l.core().handler.Handler()
+	l.core().handler.Replace(handler)
+	if fh, ok := old.(*fileHandler); ok && handler != old {
+		fh.Close()
+	}
 }
 
 // Handler returns current handler for this logger
 func (l *Logger) Handler() Handler {
-	return l.handler.Handler()
+	return l.core().handler.Handler()
 }
 
-// Level returns minimal level that this logger will process.
+// Level returns minimal level that is set for this logger. If it is NOTSET,
+// logger uses level of its parent, see EffectiveLevel.
 func (l *Logger) Level() Level {
-	return l.level
+	return Level(atomic.LoadUint64(&l.core().level))
+}
+
+// EffectiveLevel returns minimal level that this logger will process.
+// This is level set for this logger, or if it is NOTSET, effective level
+// of its parent. Root logger with NOTSET level processes all records.
+func (l *Logger) EffectiveLevel() Level {
+	for current := l.core(); current != nil; current = current.relationship.parent {
+		if level := current.Level(); level != NOTSET {
+			return level
+		}
+	}
+	return NOTSET
+}
+
+// SetLevel sets minimal level that this logger will process. Setting it to
+// NOTSET makes logger use level of its parent. It is safe to call it while
+// logger is in use.
+func (l *Logger) SetLevel(level Level) {
+	atomic.StoreUint64(&l.core().level, uint64(level))
+}
+
+// SetLevelRecursive sets minimal level to this logger and all its
+// descendants.
+func (l *Logger) SetLevelRecursive(level Level) {
+	l = l.core()
+	l.SetLevel(level)
+	l.relationship.RLock()
+	defer l.relationship.RUnlock()
+	for _, child := range l.relationship.children {
+		child.SetLevelRecursive(level)
+	}
+}
+
+// Parent returns parent of this logger, or nil for root logger.
+func (l *Logger) Parent() *Logger {
+	return l.core().relationship.parent
+}
+
+// Children returns all loggers that have this logger as parent, sorted
+// by name.
+func (l *Logger) Children() []*Logger {
+	l = l.core()
+	l.relationship.RLock()
+	children := make([]*Logger, 0, len(l.relationship.children))
+	for _, child := range l.relationship.children {
+		children = append(children, child)
+	}
+	l.relationship.RUnlock()
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].name < children[j].name
+	})
+	return children
+}
+
+// Propagates returns true if records logged with this logger are passed
+// to its parent for processing.
+func (l *Logger) Propagates() bool {
+	return !l.core().relationship.preventPropagation
+}
+
+// QueueLength returns number of records queued in this logger that are
+// not processed yet.
+func (l *Logger) QueueLength() int {
+	return int(atomic.LoadInt32(&l.core().toProcess))
 }
 
 // Name returns name of this logger.
@@ -331,27 +511,44 @@ func (l *Logger) Name() string {
 // separated by ".". This happens recursively, so return value will contain
 // names of all parents.
 func (l *Logger) FullName() string {
-	if l.relationship.parent != nil {
-		parentFullName := l.relationship.parent.FullName()
-		if parentFullName != "" {
-			return l.relationship.parent.FullName() + "." + l.name
-		}
-	}
-	return l.name
+	return l.fullName
 }
 
 // handle is log record processor which takes records from chan and invokes all handlers.
 func (l *Logger) handle() {
+	defer close(l.finished)
 	var notifyFinished chan struct{}
+	// batch is reused for records passed to batch handler
+	var batch []Record
+	// dropDeadline is set while report about dropped records waits for
+	// queue to drain
+	var dropDeadline <-chan time.Time
 	for {
 		select {
 		case record, ok := <-l.records:
 			if !ok {
+				// report records dropped after queue was drained last time
+				l.reportDropped()
 				return
 			}
-			l.handler.Handle(record)
+			count := 1
+			if batchHandler, ok := l.handler.Handler().(BatchHandler); ok {
+				batch = l.drain(append(batch[:0], record))
+				count = len(batch)
+				l.processBatch(batchHandler, batch)
+			} else {
+				l.process(record)
+			}
+
+			// once queue is drained, report records that were dropped
+			// because it was full, so that loss is visible in output.
+			// Warning is processed before current record is accounted
+			// for, so that waiters are not released before it is processed.
+			if len(l.records) == 0 {
+				l.reportDropped()
+			}
 
-			atomic.AddInt32(&l.toProcess, -1)
+			atomic.AddInt32(&l.toProcess, -int32(count))
 			// if count dropped to 0, close notification channel
 			if atomic.LoadInt32(&l.toProcess) == 0 && notifyFinished != nil {
 				close(notifyFinished)
@@ -361,80 +558,275 @@ func (l *Logger) handle() {
 		case notifyFinished = <-l.notifyFinished:
 			// check count right away and notify that processing is done if possible
 			if atomic.LoadInt32(&l.toProcess) == 0 {
+				l.reportDropped()
 				close(notifyFinished)
 				// reset notification channel
 				notifyFinished = nil
 			}
+		case <-l.dropped.notify:
+			// records were dropped, report them right away if worker is
+			// idle, otherwise once queue drains, but not later then
+			// droppedWarningDelay, since queue might never drain.
+			if len(l.records) == 0 {
+				l.reportDropped()
+			} else if dropDeadline == nil {
+				dropDeadline = time.After(droppedWarningDelay)
+			}
+		case <-dropDeadline:
+			dropDeadline = nil
+			l.reportDropped()
 		}
 	}
 }
 
-// buildContext builds context from this logger ant all its parents.
-// TODO: Maybe keep context stating per logger, so that we do not have to build it all the time
-func (l *Logger) buildContext() Ctx {
-	if l.relationship.parent == nil {
-		return l.context
+// process passes record to handler of this logger.
+func (l *Logger) process(record Record) {
+	start := time.Now()
+	err := l.handler.Handle(record)
+	l.recordHandled(start, 1, err)
+	if err != nil {
+		l.errorHandler(err, failedRecord(err, record))
 	}
-	return l.relationship.parent.context.merge(l.context)
 }
 
-// processRecords creates full records from provided user record and this and
-// all parents contexts.
-func (l *Logger) processRecords() {
-	for {
+// drain appends records waiting in queue to provided batch, without
+// blocking and up to maxWorkerBatch records.
+func (l *Logger) drain(batch []Record) []Record {
+	for len(batch) < maxWorkerBatch {
 		select {
-		case record, ok := <-l.rawRecords:
+		case record, ok := <-l.records:
 			if !ok {
-				return
+				return batch
 			}
+			batch = append(batch, record)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// processBatch passes records to batch handler of this logger. If handler
+// fails, error handler is called once, with first record of batch.
+func (l *Logger) processBatch(handler BatchHandler, batch []Record) {
+	start := time.Now()
+	err := handler.HandleBatch(batch)
+	l.recordHandled(start, len(batch), err)
+	if err != nil {
+		l.errorHandler(err, failedRecord(err, batch[0]))
+	}
+}
 
-			record.Context = l.buildContext().merge(record.Context)
+// failedRecord returns record that handler error relates to. That is first
+// record of failed batch if error is *BatchError, or provided record
+// otherwise.
+func failedRecord(err error, record Record) Record {
+	var batchErr *BatchError
+	if errors.As(err, &batchErr) {
+		return batchErr.Record
+	}
+	return record
+}
 
-			l.records <- record
-			if !l.relationship.preventPropagation && l.relationship.parent != nil {
-				l.relationship.parent.log(-1, record)
+// flush flushes handlers of this logger and all its descendants that
+// implement Flusher. Errors are passed to error handler of logger.
+func (l *Logger) flush() {
+	l.core().walk(func(logger *Logger) {
+		if flusher, ok := logger.Handler().(Flusher); ok {
+			if err := flusher.Flush(); err != nil {
+				logger.errorHandler(err, Record{Logger: logger, LoggerName: logger.fullName})
 			}
 		}
+	})
+}
+
+// contextGeneration is incremented every time context of any logger
+// changes, which invalidates merged contexts cached by all loggers.
+// Context changes are rare, so there is no need for finer invalidation.
+var contextGeneration uint64
+
+// buildContext returns context of this logger merged with contexts of all
+// its parents, where contexts of closer loggers have priority. Result is
+// cached until context of some logger changes, so it must not be modified.
+func (l *Logger) buildContext() Ctx {
+	// generation is read before building, so if context changes while
+	// building, cached value is considered stale on next call.
+	generation := atomic.LoadUint64(&contextGeneration)
+	l.context.RLock()
+	merged, own := l.context.merged, l.context.own
+	valid := merged != nil && l.context.generation == generation
+	l.context.RUnlock()
+	if valid {
+		return merged
+	}
+
+	var inherited Ctx
+	if parent := l.relationship.parent; parent != nil {
+		inherited = parent.buildContext()
+	}
+	merged = inherited.merge(own)
+
+	l.context.Lock()
+	l.context.merged = merged
+	l.context.generation = generation
+	l.context.Unlock()
+	return merged
+}
+
+// Context returns copy of context of this logger merged with contexts of
+// all its parents. For derived loggers (see With), their own context is
+// merged over context of logger they are derived from.
+func (l *Logger) Context() Ctx {
+	if l.base != nil {
+		return l.base.buildContext().merge(l.context.own)
+	}
+	return l.buildContext().merge(nil)
+}
+
+// SetContext replaces context of this logger with provided one. Records
+// logged after this call will have new context, as well as records of
+// all descendants of this logger. It is safe to call it while logger is
+// in use. For derived loggers (see With), context of logger they are
+// derived from is changed.
+func (l *Logger) SetContext(ctx Ctx) {
+	l.updateContext(func(Ctx) Ctx {
+		return Ctx(nil).merge(ctx)
+	})
+}
+
+// AddContext adds provided key-value pairs to context of this logger,
+// replacing existing values with same keys. See SetContext.
+func (l *Logger) AddContext(ctx Ctx) {
+	l.updateContext(func(own Ctx) Ctx {
+		return own.merge(ctx)
+	})
+}
+
+// updateContext replaces own context of logger with one returned by update
+// and invalidates cached contexts.
+func (l *Logger) updateContext(update func(own Ctx) Ctx) {
+	l = l.core()
+	l.context.Lock()
+	l.context.own = update(l.context.own)
+	l.context.Unlock()
+	atomic.AddUint64(&contextGeneration, 1)
+}
+
+// sinks returns loggers that should handle records created by this logger.
+// This is logger itself followed by all parents that records propagate to.
+// Since parents and propagation flags do not change once logger is part of
+// tree, result is resolved once and cached.
+func (l *Logger) sinks() []*Logger {
+	l.relationship.RLock()
+	sinks := l.relationship.sinks
+	l.relationship.RUnlock()
+	if sinks != nil {
+		return sinks
+	}
+
+	for current := l; current != nil; current = current.relationship.parent {
+		sinks = append(sinks, current)
+		if current.relationship.preventPropagation {
+			break
+		}
 	}
+
+	l.relationship.Lock()
+	l.relationship.sinks = sinks
+	l.relationship.Unlock()
+	return sinks
 }
 
-// log creates record suitable for processing and sends it to messages chan.
+// log builds final record by merging it with context of this logger and
+// all its parents and adding caller information, and queues it for
+// handling in this logger and all loggers that it propagates to. Record is
+// built only once, every logger that handles it gets same record.
 func (l *Logger) log(calldepth int, record Record) {
-	l.state.RLock()
-	defer l.state.RUnlock()
-	if l.state.val == loggerStopped || !l.IsEnabledFor(record.Level) {
+	if l.base != nil {
+		// derived logger only adds its context, record is processed by
+		// logger it is derived from.
+		record.Context = l.context.own.merge(record.Context)
+		record.Logger = l.base
+		if calldepth > 0 {
+			calldepth++
+		}
+		l.base.log(calldepth, record)
+		return
+	}
+	if !l.IsEnabledFor(record.Level) {
+		l.stats.filtered.inc(record.Level)
 		return
 	}
 
-	var file string
-	var line int
-	var gotCaller bool
+	record.Context = l.buildContext().merge(record.Context)
 	if l.includeFileAndLine && calldepth > 0 {
-		_, file, line, gotCaller = runtime.Caller(calldepth)
+		var gotCaller bool
+		_, record.File, record.Line, gotCaller = runtime.Caller(calldepth)
 		if !gotCaller {
-			file = "???"
-			line = -1
+			record.File = "???"
+			record.Line = -1
 		}
 	}
 
-	record.File = file
-	record.Line = line
+	for i, sink := range l.sinks() {
+		// record is filtered only by effective level of logger that created
+		// it, so it reaches handlers of all loggers it propagates to, like
+		// in Python logging. Propagation stops at first logger that is
+		// stopped.
+		if !sink.queue(record) {
+			return
+		}
+		if i == 0 {
+			l.stats.logged.inc(record.Level)
+		}
+	}
+}
 
+// queue puts record to queue of this logger's worker. It returns false if
+// logger is stopped and record is not queued.
+func (l *Logger) queue(record Record) bool {
+	l.state.RLock()
+	defer l.state.RUnlock()
+	if l.state.val == loggerStopped {
+		return false
+	}
 	atomic.AddInt32(&l.toProcess, 1)
-	l.rawRecords <- record
+	l.enqueue(record)
+	return true
 }
 
 // Stop stops listening for new messages sent to this logger.
 // Messages already sent will be processed, but all new messages will
 // silently be dropped.
-// Stopping loggers stops processing goroutines and cleans up resources.
+// Stopping loggers stops processing goroutine and cleans up resources.
 func (l *Logger) stopAndWait(waitFunc func()) {
+	if l.base != nil {
+		// derived logger has nothing to stop, logger it is derived from
+		// keeps running.
+		waitFunc()
+		return
+	}
+	if !l.stop(waitFunc) {
+		return
+	}
+	// close handler, if it supports closing.
+	if handlerCloser, ok := l.Handler().(HandlerCloser); ok {
+		handlerCloser.Close()
+	}
+}
+
+// stop marks logger as stopped, detaches it from its parent, calls waitFunc
+// that should wait for queued records to be processed and stops worker
+// goroutine. Handler is not closed. It returns false if logger was already
+// stopped.
+func (l *Logger) stop(waitFunc func()) bool {
 	l.state.Lock()
 	defer l.state.Unlock()
+	if l.state.val == loggerStopped {
+		return false
+	}
 	// mark logger as stopped
 	l.state.val = loggerStopped
-	// stop processing of raw records
-	close(l.rawRecords)
 	// break relationship
 	if l.relationship.parent != nil {
 		l.relationship.parent.removeChild(l)
@@ -443,10 +835,7 @@ func (l *Logger) stopAndWait(waitFunc func()) {
 	waitFunc()
 	// stop processing all records
 	close(l.records)
-	// close handler, if it supports closing.
-	if handlerCloser, ok := l.Handler().(HandlerCloser); ok {
-		handlerCloser.Close()
-	}
+	return true
 }
 
 // StopAndWait stops listening for new messages sent to this logger and
@@ -472,6 +861,7 @@ func (l *Logger) StopAndWaitTimeout(t time.Duration) (finished bool) {
 
 // IsRunning returns boolean indicating if this logger is still running.
 func (l *Logger) IsRunning() bool {
+	l = l.core()
 	l.state.RLock()
 	defer l.state.RUnlock()
 	return l.state.val == loggerRunning
@@ -481,13 +871,20 @@ func (l *Logger) IsRunning() bool {
 // Provided done channel will be closed when messages are processed to notify
 // interested parties that they can unblock.
 func (l *Logger) wait(done chan struct{}) {
+	l = l.core()
 	runtime.Gosched()
 	l.relationship.RLock()
 	defer l.relationship.RUnlock()
 	var wg sync.WaitGroup
 	wg.Add(len(l.relationship.children) + 1)
 	go func() {
-		l.notifyFinished <- done
+		select {
+		case l.notifyFinished <- done:
+		case <-l.finished:
+			// worker of stopped logger has exited, so there is nothing
+			// left to wait for
+			close(done)
+		}
 		wg.Done()
 	}()
 	for _, child := range l.relationship.children {
@@ -502,11 +899,13 @@ func (l *Logger) wait(done chan struct{}) {
 }
 
 // Wait block until all messages sent to logger are processed.
-// If timeout is needed, see WaitTimeout.
+// If timeout is needed, see WaitTimeout. Once messages are processed,
+// handlers that implement Flusher are flushed.
 func (l *Logger) Wait() {
 	done := make(chan struct{})
 	l.wait(done)
 	<-done
+	l.flush()
 }
 
 // WaitTimeout blocks until all messages send to logger are processed or max
@@ -519,6 +918,7 @@ func (l *Logger) WaitTimeout(t time.Duration) (finished bool) {
 	l.wait(done)
 	select {
 	case <-done:
+		l.flush()
 		return true
 	case <-timeout:
 		return false
@@ -537,13 +937,35 @@ func (l *Logger) WaitTimeout(t time.Duration) (finished bool) {
 func (l *Logger) Log(calldepth int, level Level, message string, pairs ...interface{}) {
 	// if level is not sufficient, do not proceed to avoid unneeded allocations
 	if !l.IsEnabledFor(level) {
+		l.core().stats.filtered.inc(level)
 		return
 	}
+	ctx := pairsToCtx(pairs)
+
+	r := Record{
+		Time:       time.Now().UTC(),
+		Level:      level,
+		Message:    message,
+		Context:    ctx,
+		Logger:     l,
+		LoggerName: l.fullName,
+	}
+	l.log(calldepth+1, r)
+}
+
+// pairsToCtx creates context from provided key-value pairs, with semantics
+// described in Log method.
+func pairsToCtx(pairs []interface{}) Ctx {
 	var ctx = make(Ctx)
 
-	// make sure that number of items in data is even
 	pairsNo := len(pairs)
-	if pairsNo%2 != 0 && pairsNo > 0 {
+	for i := 0; i+1 < pairsNo; i += 2 {
+		keyStr := fmt.Sprintf("%v", pairs[i])
+		ctx[keyStr] = pairs[i+1]
+	}
+
+	// make sure that number of items in data is even
+	if pairsNo%2 != 0 {
 		// If there is no even number of items provided - add dummy values and
 		// indicate that there was a problem.
 		// However, if last provided unpaired item is instance of error,
@@ -551,39 +973,30 @@ func (l *Logger) Log(calldepth int, level Level, message string, pairs ...interf
 		// for logging stuff in format ligno.Error("Description", err)
 		last := pairs[pairsNo-1]
 		if _, ok := last.(error); ok {
-			pairs = append(pairs[:pairsNo-1], "err", last)
+			ctx["err"] = last
 		} else {
-			pairs = append(pairs, []interface{}{nil, "error", "missing key"}...)
+			ctx[fmt.Sprintf("%v", last)] = nil
+			ctx["error"] = "missing key"
 		}
 	}
-	for i := 0; i < len(pairs); i += 2 {
-		keyStr := fmt.Sprintf("%v", pairs[i])
-		ctx[keyStr] = pairs[i+1]
-	}
-
-	r := Record{
-		Time:    time.Now().UTC(),
-		Level:   level,
-		Message: message,
-		Context: ctx,
-		Logger:  l,
-	}
-	l.log(calldepth+1, r)
+	return ctx
 }
 
 // LogCtx adds provided message in specified level.
 func (l *Logger) LogCtx(calldepth int, level Level, message string, data Ctx) {
 	// if level is not sufficient, do not proceed to avoid unneeded allocations
 	if !l.IsEnabledFor(level) {
+		l.core().stats.filtered.inc(level)
 		return
 	}
 
 	r := Record{
-		Time:    time.Now().UTC(),
-		Level:   level,
-		Message: message,
-		Context: data,
-		Logger:  l,
+		Time:       time.Now().UTC(),
+		Level:      level,
+		Message:    message,
+		Context:    data,
+		Logger:     l,
+		LoggerName: l.fullName,
 	}
 	l.log(calldepth+1, r)
 }
@@ -645,7 +1058,7 @@ func (l *Logger) CriticalCtx(message string, ctx Ctx) {
 
 // IsEnabledFor returns true if logger will process records with provided level.
 func (l *Logger) IsEnabledFor(level Level) bool {
-	return l.Level() <= level
+	return l.EffectiveLevel() <= level
 }
 
 // IsDebug returns true if logger will process messages in DEBUG level
@@ -9,7 +9,9 @@ import (
 	"os"
 	"runtime"
 	"runtime/debug"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 	//	"flag"
@@ -183,6 +185,22 @@ func BenchmarkPrint(b *testing.B) {
 	}
 }
 
+func BenchmarkLogPropagation(b *testing.B) {
+	root := GetLoggerOptions("bench."+randString(), LoggerOptions{
+		Context:            Ctx{"service": "bench"},
+		Handler:            NullHandler(),
+		PreventPropagation: true,
+	})
+	l := root.SubLogger("a").SubLogger("b").SubLogger("c")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Info("message", "i", i)
+	}
+	root.Wait()
+	b.StopTimer()
+	root.StopAndWait()
+}
+
 func TestNilHandler(t *testing.T) {
 	l := GetLoggerOptions("test.2",
 		LoggerOptions{
@@ -206,3 +224,228 @@ func TestContext(t *testing.T) {
 	l2.Info("L2 event", "foo", "bar")
 	l1.Wait()
 }
+
+// overflowFormat formats record as its level, message and number of dropped
+// records from context.
+func overflowFormat() Formatter {
+	return FormatterFunc(func(record Record) []byte {
+		return []byte(fmt.Sprintf("%s %s %v", record.Level, record.Message, record.Context["dropped"]))
+	})
+}
+
+// expectMessages checks that handler got exactly provided messages.
+func expectMessages(t *testing.T, memory InspectHandler, expected ...string) {
+	messages := memory.Messages()
+	if len(messages) != len(expected) {
+		t.Fatalf("Expected messages %v, got %v", expected, messages)
+	}
+	for i := range expected {
+		if messages[i] != expected[i] {
+			t.Errorf("Expected message %q, got %q", expected[i], messages[i])
+		}
+	}
+}
+
+func TestOverflowDropNewest(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	memory := MemoryHandler(overflowFormat())
+	l := GetLoggerOptions("overflow."+randString(), LoggerOptions{
+		Handler: HandlerFunc(func(record Record) error {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			<-release
+			return memory.Handle(record)
+		}),
+		BufferSize:         1,
+		OverflowPolicy:     DropNewest,
+		PreventPropagation: true,
+	})
+	// worker takes first record and blocks in handler, so second one fills
+	// queue and all others are dropped
+	l.Info("0")
+	<-started
+	for i := 1; i < 20; i++ {
+		l.Info(strconv.Itoa(i))
+	}
+	if dropped := l.Dropped(); dropped != 18 {
+		t.Fatalf("Expected 18 dropped records, got %d", dropped)
+	}
+	// nothing is logged after drops, warning must still be emitted
+	close(release)
+	l.Wait()
+	expectMessages(t, memory,
+		"INFO 0 <nil>",
+		"INFO 1 <nil>",
+		"WARNING Records dropped because logger queue was full. 18",
+	)
+	l.StopAndWait()
+}
+
+func TestDroppedWarningWhenIdle(t *testing.T) {
+	memory := MemoryHandler(overflowFormat())
+	l := GetLoggerOptions("overflow."+randString(), LoggerOptions{
+		Handler:            memory,
+		PreventPropagation: true,
+	})
+	// simulate record that was dropped after worker processed last record,
+	// so no record is processed after drop
+	atomic.AddInt32(&l.toProcess, 1)
+	l.recordDropped()
+	deadline := time.Now().Add(droppedWarningDelay / 2)
+	for len(memory.Messages()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	expectMessages(t, memory, "WARNING Records dropped because logger queue was full. 1")
+	l.StopAndWait()
+}
+
+func TestOverflowDropOldest(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	memory := MemoryHandler(overflowFormat())
+	l := GetLoggerOptions("overflow."+randString(), LoggerOptions{
+		Handler: HandlerFunc(func(record Record) error {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			<-release
+			return memory.Handle(record)
+		}),
+		BufferSize:         1,
+		OverflowPolicy:     DropOldest,
+		PreventPropagation: true,
+	})
+	// worker takes first record and blocks in handler, so all others
+	// compete for single place in queue
+	l.Info("0")
+	<-started
+	for i := 1; i < 20; i++ {
+		l.Info(strconv.Itoa(i))
+	}
+	if dropped := l.Dropped(); dropped != 18 {
+		t.Fatalf("Expected 18 dropped records, got %d", dropped)
+	}
+	close(release)
+	l.StopAndWait()
+	expectMessages(t, memory,
+		"INFO 0 <nil>",
+		"INFO 19 <nil>",
+		"WARNING Records dropped because logger queue was full. 18",
+	)
+}
+
+func TestOverflowBlockWithTimeout(t *testing.T) {
+	release := make(chan struct{})
+	l := GetLoggerOptions("overflow."+randString(), LoggerOptions{
+		Handler: HandlerFunc(func(record Record) error {
+			<-release
+			return nil
+		}),
+		BufferSize:         1,
+		OverflowPolicy:     BlockWithTimeout,
+		OverflowTimeout:    time.Millisecond,
+		PreventPropagation: true,
+	})
+	for i := 0; i < 10; i++ {
+		l.Info("message")
+	}
+	if l.Dropped() == 0 {
+		t.Fatal("Expected some records to be dropped.")
+	}
+	close(release)
+	l.StopAndWait()
+}
+
+func TestErrorHandler(t *testing.T) {
+	var mu sync.Mutex
+	var failed []Record
+	l := GetLoggerOptions("errors."+randString(), LoggerOptions{
+		Handler: HandlerFunc(func(record Record) error {
+			return fmt.Errorf("broken handler")
+		}),
+		ErrorHandler: func(err error, record Record) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed = append(failed, record)
+		},
+		PreventPropagation: true,
+	})
+	l.Info("first")
+	l.Info("second")
+	l.StopAndWait()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(failed) != 2 {
+		t.Fatalf("Expected 2 failed records, got %d.", len(failed))
+	}
+	if failed[0].Message != "first" || failed[1].Message != "second" {
+		t.Errorf("Unexpected failed records: %v", failed)
+	}
+}
+
+func TestRecordLoggerName(t *testing.T) {
+	name := "names." + randString() + "." + randString()
+	memory := MemoryHandler(FormatterFunc(func(record Record) []byte {
+		return []byte(record.LoggerName)
+	}))
+	l := GetLoggerOptions(name, LoggerOptions{
+		Handler:            memory,
+		PreventPropagation: true,
+	})
+	l.Info("message")
+	l.Wait()
+	if messages := memory.Messages(); len(messages) != 1 || messages[0] != name {
+		t.Errorf("Expected logger name %s, got %v", name, messages)
+	}
+}
+
+func TestPropagationUsesOriginLevel(t *testing.T) {
+	memory := MemoryHandler(messageFormat())
+	db := GetLoggerOptions("db"+randString(), LoggerOptions{
+		Level:              INFO,
+		Handler:            memory,
+		PreventPropagation: true,
+	})
+	pool := db.SubLogger("pool")
+	pool.SetLevel(DEBUG)
+	pool.Debug("from pool")
+	db.Debug("from db")
+	pool.Wait()
+	db.Wait()
+	expectMessages(t, memory, "from pool\n")
+	db.StopAndWait()
+}
+
+func TestSetLevelInheritance(t *testing.T) {
+	parent := GetLoggerOptions("levels."+randString(), LoggerOptions{
+		Level:              INFO,
+		Handler:            NullHandler(),
+		PreventPropagation: true,
+	})
+	child := parent.SubLogger("child")
+	grandchild := child.SubLogger("grandchild")
+
+	if grandchild.Level() != NOTSET || grandchild.EffectiveLevel() != INFO {
+		t.Errorf("Expected inherited INFO level, got %s (effective %s)", grandchild.Level(), grandchild.EffectiveLevel())
+	}
+	if grandchild.IsDebug() {
+		t.Error("Expected DEBUG to be disabled through inheritance.")
+	}
+
+	child.SetLevel(DEBUG)
+	if !grandchild.IsDebug() || parent.IsDebug() {
+		t.Error("Expected DEBUG to be enabled only for child subtree.")
+	}
+
+	parent.SetLevelRecursive(ERROR)
+	for _, l := range []*Logger{parent, child, grandchild} {
+		if l.Level() != ERROR {
+			t.Errorf("Expected ERROR level for %s, got %s", l.FullName(), l.Level())
+		}
+	}
+	parent.StopAndWait()
+}
@@ -0,0 +1,388 @@
+package ligno
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// This file holds minimal MessagePack encoder and decoder, with just enough
+// of specification implemented for Fluent Forward protocol.
+
+// maxMsgpackLength is max length of string, binary, array or map that
+// decoder accepts, so that invalid input can not cause huge allocation.
+const maxMsgpackLength = 64 << 20
+
+// errMsgpackLength is returned by decoder for too long values.
+var errMsgpackLength = errors.New("msgpack value is too long")
+
+// msgpackExt is decoded value of extension type.
+type msgpackExt struct {
+	Type int8
+	Data []byte
+}
+
+// msgpackEncoder writes MessagePack encoded values to buffer.
+type msgpackEncoder struct {
+	buff *bytes.Buffer
+}
+
+// writePrefixed writes single byte prefix followed by big endian number of
+// provided size.
+func (e msgpackEncoder) writePrefixed(prefix byte, value uint64, size int) {
+	e.buff.WriteByte(prefix)
+	for i := size - 1; i >= 0; i-- {
+		e.buff.WriteByte(byte(value >> (8 * uint(i))))
+	}
+}
+
+// writeNil writes nil.
+func (e msgpackEncoder) writeNil() {
+	e.buff.WriteByte(0xc0)
+}
+
+// writeBool writes boolean.
+func (e msgpackEncoder) writeBool(value bool) {
+	if value {
+		e.buff.WriteByte(0xc3)
+	} else {
+		e.buff.WriteByte(0xc2)
+	}
+}
+
+// writeUint writes unsigned integer in shortest form.
+func (e msgpackEncoder) writeUint(value uint64) {
+	switch {
+	case value <= 0x7f:
+		e.buff.WriteByte(byte(value))
+	case value <= math.MaxUint8:
+		e.writePrefixed(0xcc, value, 1)
+	case value <= math.MaxUint16:
+		e.writePrefixed(0xcd, value, 2)
+	case value <= math.MaxUint32:
+		e.writePrefixed(0xce, value, 4)
+	default:
+		e.writePrefixed(0xcf, value, 8)
+	}
+}
+
+// writeInt writes signed integer in shortest form.
+func (e msgpackEncoder) writeInt(value int64) {
+	switch {
+	case value >= 0:
+		e.writeUint(uint64(value))
+	case value >= -32:
+		e.buff.WriteByte(byte(value))
+	case value >= math.MinInt8:
+		e.writePrefixed(0xd0, uint64(value), 1)
+	case value >= math.MinInt16:
+		e.writePrefixed(0xd1, uint64(value), 2)
+	case value >= math.MinInt32:
+		e.writePrefixed(0xd2, uint64(value), 4)
+	default:
+		e.writePrefixed(0xd3, uint64(value), 8)
+	}
+}
+
+// writeFloat32 writes single precision float.
+func (e msgpackEncoder) writeFloat32(value float32) {
+	e.writePrefixed(0xca, uint64(math.Float32bits(value)), 4)
+}
+
+// writeFloat64 writes double precision float.
+func (e msgpackEncoder) writeFloat64(value float64) {
+	e.writePrefixed(0xcb, math.Float64bits(value), 8)
+}
+
+// writeString writes string.
+func (e msgpackEncoder) writeString(value string) {
+	length := uint64(len(value))
+	switch {
+	case length <= 31:
+		e.buff.WriteByte(0xa0 | byte(length))
+	case length <= math.MaxUint8:
+		e.writePrefixed(0xd9, length, 1)
+	case length <= math.MaxUint16:
+		e.writePrefixed(0xda, length, 2)
+	default:
+		e.writePrefixed(0xdb, length, 4)
+	}
+	e.buff.WriteString(value)
+}
+
+// writeBinary writes binary data.
+func (e msgpackEncoder) writeBinary(value []byte) {
+	length := uint64(len(value))
+	switch {
+	case length <= math.MaxUint8:
+		e.writePrefixed(0xc4, length, 1)
+	case length <= math.MaxUint16:
+		e.writePrefixed(0xc5, length, 2)
+	default:
+		e.writePrefixed(0xc6, length, 4)
+	}
+	e.buff.Write(value)
+}
+
+// writeArrayHeader writes header of array with provided number of items.
+func (e msgpackEncoder) writeArrayHeader(length int) {
+	switch {
+	case length <= 15:
+		e.buff.WriteByte(0x90 | byte(length))
+	case length <= math.MaxUint16:
+		e.writePrefixed(0xdc, uint64(length), 2)
+	default:
+		e.writePrefixed(0xdd, uint64(length), 4)
+	}
+}
+
+// writeMapHeader writes header of map with provided number of entries.
+func (e msgpackEncoder) writeMapHeader(length int) {
+	switch {
+	case length <= 15:
+		e.buff.WriteByte(0x80 | byte(length))
+	case length <= math.MaxUint16:
+		e.writePrefixed(0xde, uint64(length), 2)
+	default:
+		e.writePrefixed(0xdf, uint64(length), 4)
+	}
+}
+
+// writeEventTime writes time as Fluent EventTime extension, which holds
+// seconds and nanoseconds since epoch.
+func (e msgpackEncoder) writeEventTime(t time.Time) {
+	e.buff.WriteByte(0xd7)
+	e.buff.WriteByte(0x00)
+	var data [8]byte
+	binary.BigEndian.PutUint32(data[:4], uint32(t.Unix()))
+	binary.BigEndian.PutUint32(data[4:], uint32(t.Nanosecond()))
+	e.buff.Write(data[:])
+}
+
+// writeValue writes arbitrary value. Values that do not have MessagePack
+// representation are written as strings, formatted same way as in other
+// formatters (see formatValue).
+func (e msgpackEncoder) writeValue(value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		e.writeNil()
+	case bool:
+		e.writeBool(v)
+	case int:
+		e.writeInt(int64(v))
+	case int8:
+		e.writeInt(int64(v))
+	case int16:
+		e.writeInt(int64(v))
+	case int32:
+		e.writeInt(int64(v))
+	case int64:
+		e.writeInt(v)
+	case uint:
+		e.writeUint(uint64(v))
+	case uint8:
+		e.writeUint(uint64(v))
+	case uint16:
+		e.writeUint(uint64(v))
+	case uint32:
+		e.writeUint(uint64(v))
+	case uint64:
+		e.writeUint(v)
+	case float32:
+		e.writeFloat32(v)
+	case float64:
+		e.writeFloat64(v)
+	case string:
+		e.writeString(v)
+	case []byte:
+		e.writeBinary(v)
+	case time.Time:
+		e.writeString(v.Format(time.RFC3339Nano))
+	case []interface{}:
+		e.writeArrayHeader(len(v))
+		for _, item := range v {
+			e.writeValue(item)
+		}
+	case Ctx:
+		e.writeMap(v)
+	case map[string]interface{}:
+		e.writeMap(v)
+	default:
+		e.writeString(formatValue(v))
+	}
+}
+
+// writeMap writes map with string keys.
+func (e msgpackEncoder) writeMap(value map[string]interface{}) {
+	e.writeMapHeader(len(value))
+	for key, item := range value {
+		e.writeString(key)
+		e.writeValue(item)
+	}
+}
+
+// readMsgpack reads single value from reader. Integers are decoded as
+// int64, except unsigned ones that do not fit in it, which are decoded as
+// uint64. Strings are decoded as string, binaries as []byte, arrays as
+// []interface{}, maps as map[string]interface{}, where keys that are not
+// strings are formatted with formatValue, and extensions as msgpackExt.
+func readMsgpack(r *bufio.Reader) (interface{}, error) {
+	prefix, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case prefix <= 0x7f:
+		return int64(prefix), nil
+	case prefix >= 0xe0:
+		return int64(int8(prefix)), nil
+	case prefix&0xf0 == 0x80:
+		return readMsgpackMap(r, uint64(prefix&0x0f))
+	case prefix&0xf0 == 0x90:
+		return readMsgpackArray(r, uint64(prefix&0x0f))
+	case prefix&0xe0 == 0xa0:
+		data, err := readMsgpackBytes(r, uint64(prefix&0x1f))
+		return string(data), err
+	}
+
+	switch prefix {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		return readMsgpackLengthBytes(r, 1<<(prefix-0xc4))
+	case 0xc7, 0xc8, 0xc9:
+		length, err := readMsgpackUint(r, 1<<(prefix-0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackExt(r, length)
+	case 0xca:
+		bits, err := readMsgpackUint(r, 4)
+		return math.Float32frombits(uint32(bits)), err
+	case 0xcb:
+		bits, err := readMsgpackUint(r, 8)
+		return math.Float64frombits(bits), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		value, err := readMsgpackUint(r, 1<<(prefix-0xcc))
+		if value > math.MaxInt64 {
+			return value, err
+		}
+		return int64(value), err
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (prefix - 0xd0)
+		value, err := readMsgpackUint(r, size)
+		// sign extend value to 64 bits
+		shift := uint(64 - 8*size)
+		return int64(value<<shift) >> shift, err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return readMsgpackExt(r, 1<<(prefix-0xd4))
+	case 0xd9, 0xda, 0xdb:
+		data, err := readMsgpackLengthBytes(r, 1<<(prefix-0xd9))
+		return string(data), err
+	case 0xdc, 0xdd:
+		length, err := readMsgpackUint(r, 2<<(prefix-0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackArray(r, length)
+	case 0xde, 0xdf:
+		length, err := readMsgpackUint(r, 2<<(prefix-0xde))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackMap(r, length)
+	}
+	return nil, fmt.Errorf("invalid msgpack prefix 0x%x", prefix)
+}
+
+// readMsgpackUint reads big endian unsigned number of provided size.
+func readMsgpackUint(r *bufio.Reader, size int) (uint64, error) {
+	var value uint64
+	for i := 0; i < size; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		value = value<<8 | uint64(b)
+	}
+	return value, nil
+}
+
+// readMsgpackBytes reads provided number of bytes.
+func readMsgpackBytes(r *bufio.Reader, length uint64) ([]byte, error) {
+	if length > maxMsgpackLength {
+		return nil, errMsgpackLength
+	}
+	data := make([]byte, length)
+	_, err := io.ReadFull(r, data)
+	return data, err
+}
+
+// readMsgpackLengthBytes reads length of provided size followed by that
+// many bytes.
+func readMsgpackLengthBytes(r *bufio.Reader, size int) ([]byte, error) {
+	length, err := readMsgpackUint(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return readMsgpackBytes(r, length)
+}
+
+// readMsgpackExt reads type and data of extension.
+func readMsgpackExt(r *bufio.Reader, length uint64) (interface{}, error) {
+	extType, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	data, err := readMsgpackBytes(r, length)
+	return msgpackExt{Type: int8(extType), Data: data}, err
+}
+
+// readMsgpackArray reads provided number of array items.
+func readMsgpackArray(r *bufio.Reader, length uint64) (interface{}, error) {
+	if length > maxMsgpackLength {
+		return nil, errMsgpackLength
+	}
+	array := make([]interface{}, 0, length)
+	for i := uint64(0); i < length; i++ {
+		item, err := readMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, item)
+	}
+	return array, nil
+}
+
+// readMsgpackMap reads provided number of map entries.
+func readMsgpackMap(r *bufio.Reader, length uint64) (interface{}, error) {
+	if length > maxMsgpackLength {
+		return nil, errMsgpackLength
+	}
+	m := make(map[string]interface{}, length)
+	for i := uint64(0); i < length; i++ {
+		key, err := readMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+		value, err := readMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+		if s, ok := key.(string); ok {
+			m[s] = value
+		} else {
+			m[formatValue(key)] = value
+		}
+	}
+	return m, nil
+}
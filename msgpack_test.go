@@ -0,0 +1,47 @@
+package ligno
+
+import (
+	"bufio"
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected interface{}
+	}{
+		{nil, nil},
+		{true, true},
+		{5, int64(5)},
+		{-5, int64(-5)},
+		{200, int64(200)},
+		{-200, int64(-200)},
+		{70000, int64(70000)},
+		{int64(math.MinInt64), int64(math.MinInt64)},
+		{uint64(math.MaxUint64), uint64(math.MaxUint64)},
+		{float32(1.5), float32(1.5)},
+		{2.5, 2.5},
+		{"short", "short"},
+		{strings.Repeat("x", 300), strings.Repeat("x", 300)},
+		{[]byte{1, 2}, []byte{1, 2}},
+		{[]interface{}{1, "a"}, []interface{}{int64(1), "a"}},
+		{Ctx{"key": "value"}, map[string]interface{}{"key": "value"}},
+		{struct{ A int }{1}, "{A:1}"},
+	}
+	for _, test := range tests {
+		buff := new(bytes.Buffer)
+		msgpackEncoder{buff}.writeValue(test.value)
+		got, err := readMsgpack(bufio.NewReader(buff))
+		if err != nil {
+			t.Errorf("Unexpected error decoding %v: %v", test.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Expected %#v, got %#v", test.expected, got)
+		}
+	}
+}
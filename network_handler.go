@@ -0,0 +1,484 @@
+package ligno
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultNetworkTimeout is timeout for connecting and writing if it is
+	// not set in network options.
+	DefaultNetworkTimeout = 5 * time.Second
+	// DefaultNetworkMinBackoff is delay before first reconnect attempt if it
+	// is not set in network options.
+	DefaultNetworkMinBackoff = 100 * time.Millisecond
+	// DefaultNetworkMaxBackoff is max delay between reconnect attempts if it
+	// is not set in network options.
+	DefaultNetworkMaxBackoff = 30 * time.Second
+	// DefaultNetworkBufferSize is size in bytes of formatted records kept in
+	// memory while handler is disconnected, if it is not set in network
+	// options.
+	DefaultNetworkBufferSize = 1 << 20
+	// DefaultSpoolSize is max size of spool file if it is not set in network
+	// options.
+	DefaultSpoolSize = 64 << 20
+)
+
+// spoolHeaderSize is size of length prefix of each record in spool file.
+const spoolHeaderSize = 4
+
+// NetworkOptions holds configuration of network handler.
+type NetworkOptions struct {
+	// Network is one of "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6",
+	// "unix", "unixgram" and "tcp+tls". Over datagram networks, every
+	// record is sent in separate datagram.
+	Network string
+	// Address is address of server, or path of unix socket.
+	Address string
+	// TLSConfig is configuration of TLS connection for tcp+tls network.
+	TLSConfig *tls.Config
+	// Formatter formats records before sending. Formatted records are sent
+	// as they are, so for stream networks formatter should terminate them,
+	// usually with new line. If not set, LogfmtFormat is used.
+	Formatter Formatter
+	// Timeout is timeout for connecting and writing. If not set,
+	// DefaultNetworkTimeout is used.
+	Timeout time.Duration
+	// MinBackoff is delay before first reconnect attempt. Delay is doubled
+	// after every failed attempt. If not set, DefaultNetworkMinBackoff is
+	// used.
+	MinBackoff time.Duration
+	// MaxBackoff is max delay between reconnect attempts. If not set,
+	// DefaultNetworkMaxBackoff is used.
+	MaxBackoff time.Duration
+	// BufferSize is size in bytes of formatted records kept in memory while
+	// handler is disconnected. If not set, DefaultNetworkBufferSize is used.
+	BufferSize int
+	// SpoolFile is path of file to which records are moved once memory
+	// buffer is full. Records left in spool when handler is closed are sent
+	// by handler that uses same file after it connects. If not set, records
+	// that do not fit in memory buffer are dropped.
+	SpoolFile string
+	// SpoolSize is max size of spool file in bytes. If not set,
+	// DefaultSpoolSize is used.
+	SpoolSize int64
+}
+
+// NetworkError is returned by network handler when record could not be sent
+// right away.
+type NetworkError struct {
+	// Buffered is true if record is kept in memory buffer or spool to be sent
+	// after handler reconnects, and false if record is dropped.
+	Buffered bool
+	// Err is last error that occurred while connecting or writing.
+	Err error
+}
+
+// Error is implementation of error interface.
+func (ne *NetworkError) Error() string {
+	if ne.Buffered {
+		return fmt.Sprintf("record buffered: %v", ne.Err)
+	}
+	return fmt.Sprintf("record dropped: %v", ne.Err)
+}
+
+// Unwrap returns error that occurred while connecting or writing.
+func (ne *NetworkError) Unwrap() error {
+	return ne.Err
+}
+
+// errSpoolCorrupted is returned when spool file contains invalid record.
+var errSpoolCorrupted = errors.New("spool file is corrupted")
+
+// errNotConnected is reported for records that are dropped while first
+// connection is being established.
+var errNotConnected = errors.New("not connected")
+
+// networkHandler sends formatted records to server.
+type networkHandler struct {
+	mu      sync.Mutex
+	options NetworkOptions
+	conn    net.Conn
+	err     error
+	backoff time.Duration
+	retry   *time.Timer
+	// dialing is set while connection is being established and closed
+	// once dialing is done.
+	dialing chan struct{}
+	// memory holds records that are waiting to be sent after records in
+	// spool, in order in which they were handled
+	memory     [][]byte
+	memorySize int
+	spool      *os.File
+	// spoolSize is size of spool file and spoolOffset position of first
+	// record in it that is not sent yet
+	spoolSize   int64
+	spoolOffset int64
+	closed      bool
+}
+
+// NetworkHandler creates handler that sends records to server over provided
+// network, with default options. See NetworkHandlerOptions.
+func NetworkHandler(network, addr string, formatter Formatter) Handler {
+	return NetworkHandlerOptions(NetworkOptions{
+		Network:   network,
+		Address:   addr,
+		Formatter: formatter,
+	})
+}
+
+// NetworkHandlerOptions creates handler that sends records to server, like
+// log aggregator. Connection is established in background when first record
+// is handled, so Handle never waits for it. Until handler is connected, and
+// when connecting or writing fails, records are kept in memory buffer and,
+// once it is full, moved to spool file, while handler reconnects in
+// background with exponential backoff. After reconnecting, records from spool
+// and memory buffer are sent in order in which they were handled, before any
+// new record. Records that do not fit in buffers are dropped.
+//
+// Handler returns *NetworkError for every record that is not sent right away
+// because connecting or writing failed, or that is dropped, so error handler
+// of logger can track health of connection.
+func NetworkHandlerOptions(options NetworkOptions) Handler {
+	if options.Formatter == nil {
+		options.Formatter = LogfmtFormat()
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultNetworkTimeout
+	}
+	if options.MinBackoff <= 0 {
+		options.MinBackoff = DefaultNetworkMinBackoff
+	}
+	if options.MaxBackoff <= 0 {
+		options.MaxBackoff = DefaultNetworkMaxBackoff
+	}
+	if options.MaxBackoff < options.MinBackoff {
+		options.MaxBackoff = options.MinBackoff
+	}
+	if options.BufferSize <= 0 {
+		options.BufferSize = DefaultNetworkBufferSize
+	}
+	if options.SpoolSize <= 0 {
+		options.SpoolSize = DefaultSpoolSize
+	}
+	nh := &networkHandler{options: options}
+	if options.SpoolFile != "" {
+		// records left by previous handler are sent after connecting
+		if info, err := os.Stat(options.SpoolFile); err == nil && info.Size() > 0 {
+			nh.err = nh.openSpool()
+		}
+	}
+	return nh
+}
+
+// Handle sends record to server, or buffers it if handler is not connected.
+func (nh *networkHandler) Handle(record Record) error {
+	data := nh.options.Formatter.Format(record)
+	nh.mu.Lock()
+	defer nh.mu.Unlock()
+	if nh.closed {
+		return errHandlerClosed
+	}
+	if nh.conn != nil {
+		err := nh.write(data)
+		if err == nil {
+			return nil
+		}
+		nh.fail(err)
+	} else if nh.retry == nil && nh.dialing == nil {
+		nh.retry = time.AfterFunc(0, nh.reconnect)
+	}
+	buffered := nh.buffer(data)
+	if nh.err == nil {
+		if buffered {
+			// first connection is being established, record is sent
+			// once it is
+			return nil
+		}
+		return &NetworkError{Err: errNotConnected}
+	}
+	return &NetworkError{Buffered: buffered, Err: nh.err}
+}
+
+// connect connects to server and sends buffered records. If that fails,
+// reconnect is scheduled. Caller must hold lock, which is released while
+// dialing, so that Handle does not wait for it.
+func (nh *networkHandler) connect() {
+	dialing := make(chan struct{})
+	nh.dialing = dialing
+	nh.mu.Unlock()
+	conn, err := nh.dial()
+	nh.mu.Lock()
+	nh.dialing = nil
+	close(dialing)
+	if err != nil {
+		nh.fail(err)
+		return
+	}
+	nh.conn = conn
+	if err := nh.replay(); err != nil {
+		nh.fail(err)
+		return
+	}
+	nh.err = nil
+	nh.backoff = 0
+}
+
+// dial establishes new connection with server.
+func (nh *networkHandler) dial() (net.Conn, error) {
+	if nh.options.Network == "tcp+tls" {
+		dialer := &net.Dialer{Timeout: nh.options.Timeout}
+		return tls.DialWithDialer(dialer, "tcp", nh.options.Address, nh.options.TLSConfig)
+	}
+	return net.DialTimeout(nh.options.Network, nh.options.Address, nh.options.Timeout)
+}
+
+// reconnect is called by retry timer.
+func (nh *networkHandler) reconnect() {
+	nh.mu.Lock()
+	defer nh.mu.Unlock()
+	nh.retry = nil
+	if nh.closed || nh.conn != nil || nh.dialing != nil {
+		return
+	}
+	nh.connect()
+}
+
+// fail closes connection and schedules reconnect. Caller must hold lock.
+func (nh *networkHandler) fail(err error) {
+	if nh.conn != nil {
+		nh.conn.Close()
+		nh.conn = nil
+	}
+	nh.err = err
+	nh.backoff *= 2
+	if nh.backoff == 0 {
+		nh.backoff = nh.options.MinBackoff
+	}
+	if nh.backoff > nh.options.MaxBackoff {
+		nh.backoff = nh.options.MaxBackoff
+	}
+	if nh.retry == nil && !nh.closed {
+		nh.retry = time.AfterFunc(nh.backoff, nh.reconnect)
+	}
+}
+
+// write writes single record to connection. Caller must hold lock.
+func (nh *networkHandler) write(data []byte) error {
+	nh.conn.SetWriteDeadline(time.Now().Add(nh.options.Timeout))
+	_, err := nh.conn.Write(data)
+	return err
+}
+
+// replay sends records from spool and memory buffer, removing them as they
+// are sent. Caller must hold lock.
+func (nh *networkHandler) replay() error {
+	for nh.spoolOffset < nh.spoolSize {
+		data, err := nh.readSpool(nh.spoolOffset)
+		if err != nil {
+			// nothing after invalid record can be trusted
+			nh.truncateSpool()
+			return err
+		}
+		if err := nh.write(data); err != nil {
+			return err
+		}
+		nh.spoolOffset += spoolHeaderSize + int64(len(data))
+	}
+	if nh.spool != nil && nh.spoolSize > 0 {
+		if err := nh.truncateSpool(); err != nil {
+			return err
+		}
+	}
+	for len(nh.memory) > 0 {
+		if err := nh.write(nh.memory[0]); err != nil {
+			return err
+		}
+		nh.memorySize -= len(nh.memory[0])
+		nh.memory[0] = nil
+		nh.memory = nh.memory[1:]
+	}
+	return nil
+}
+
+// buffer keeps record to be sent after reconnecting. When memory buffer is
+// full, its records are moved to spool, together with provided one. It
+// returns false if record is dropped. Caller must hold lock.
+func (nh *networkHandler) buffer(data []byte) bool {
+	// formatters may reuse returned slice, so it must be copied
+	data = append([]byte(nil), data...)
+	if nh.memorySize+len(data) <= nh.options.BufferSize {
+		nh.memory = append(nh.memory, data)
+		nh.memorySize += len(data)
+		return true
+	}
+	if nh.options.SpoolFile == "" {
+		return false
+	}
+	if err := nh.spill(data); err != nil {
+		nh.err = err
+		return false
+	}
+	return true
+}
+
+// spill appends records from memory buffer and provided records to spool
+// file. Nothing is written if spool does not have enough space for all of
+// them. Caller must hold lock.
+func (nh *networkHandler) spill(extra ...[]byte) error {
+	records := append(nh.memory, extra...)
+	size := int64(0)
+	for _, record := range records {
+		size += spoolHeaderSize + int64(len(record))
+	}
+	if nh.spoolSize+size > nh.options.SpoolSize {
+		return fmt.Errorf("spool file %s is full", nh.options.SpoolFile)
+	}
+	if nh.spool == nil {
+		if err := nh.openSpool(); err != nil {
+			return err
+		}
+	}
+	buff := make([]byte, size)
+	position := 0
+	for _, record := range records {
+		binary.BigEndian.PutUint32(buff[position:], uint32(len(record)))
+		position += spoolHeaderSize
+		position += copy(buff[position:], record)
+	}
+	if _, err := nh.spool.WriteAt(buff, nh.spoolSize); err != nil {
+		// partially written records are overwritten by next spill
+		return err
+	}
+	nh.spoolSize += size
+	nh.memory = nil
+	nh.memorySize = 0
+	return nil
+}
+
+// openSpool opens spool file. Records already in it are kept. Caller must
+// hold lock.
+func (nh *networkHandler) openSpool() error {
+	f, err := os.OpenFile(nh.options.SpoolFile, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	nh.spool = f
+	nh.spoolSize = info.Size()
+	nh.spoolOffset = 0
+	return nil
+}
+
+// readSpool reads record at provided offset of spool file. Caller must hold
+// lock.
+func (nh *networkHandler) readSpool(offset int64) ([]byte, error) {
+	header := make([]byte, spoolHeaderSize)
+	if _, err := nh.spool.ReadAt(header, offset); err != nil {
+		return nil, errSpoolCorrupted
+	}
+	length := int64(binary.BigEndian.Uint32(header))
+	if offset+spoolHeaderSize+length > nh.spoolSize {
+		return nil, errSpoolCorrupted
+	}
+	data := make([]byte, length)
+	if _, err := nh.spool.ReadAt(data, offset+spoolHeaderSize); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return data, nil
+}
+
+// truncateSpool removes all records from spool file. Caller must hold lock.
+func (nh *networkHandler) truncateSpool() error {
+	nh.spoolSize = 0
+	nh.spoolOffset = 0
+	return nh.spool.Truncate(0)
+}
+
+// compactSpool moves records that are not sent yet to beginning of spool
+// file, so that next handler that uses it does not send them again. Caller
+// must hold lock.
+func (nh *networkHandler) compactSpool() error {
+	buff := make([]byte, 32*1024)
+	var written int64
+	for read := nh.spoolOffset; read < nh.spoolSize; {
+		n, err := nh.spool.ReadAt(buff, read)
+		if n > 0 {
+			// data is always written before position it is read from
+			if _, err := nh.spool.WriteAt(buff[:n], written); err != nil {
+				return err
+			}
+			read += int64(n)
+			written += int64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	nh.spoolSize = written
+	nh.spoolOffset = 0
+	return nh.spool.Truncate(written)
+}
+
+// Close tries to send buffered records once more and closes connection.
+// Records that could not be sent are moved to spool file, if it is set, so
+// that they are sent by next handler that uses it. Otherwise, they are lost.
+// Empty spool file is removed.
+func (nh *networkHandler) Close() {
+	nh.mu.Lock()
+	defer nh.mu.Unlock()
+	if nh.closed {
+		return
+	}
+	nh.closed = true
+	if nh.retry != nil {
+		nh.retry.Stop()
+		nh.retry = nil
+	}
+	for nh.dialing != nil {
+		dialing := nh.dialing
+		nh.mu.Unlock()
+		<-dialing
+		nh.mu.Lock()
+	}
+	if nh.conn == nil && (len(nh.memory) > 0 || nh.spoolOffset < nh.spoolSize) {
+		nh.connect()
+	}
+	if nh.conn != nil {
+		nh.conn.Close()
+		nh.conn = nil
+	}
+	if nh.options.SpoolFile != "" && len(nh.memory) > 0 {
+		if err := nh.spill(); err != nil {
+			defaultErrorHandler(&NetworkError{Err: err}, Record{})
+		}
+	}
+	if nh.spool == nil {
+		return
+	}
+	if nh.spoolOffset > 0 {
+		if err := nh.compactSpool(); err != nil {
+			defaultErrorHandler(&NetworkError{Err: err}, Record{})
+		}
+	}
+	empty := nh.spoolSize == 0
+	nh.spool.Close()
+	nh.spool = nil
+	if empty {
+		os.Remove(nh.options.SpoolFile)
+	}
+}
@@ -0,0 +1,210 @@
+package ligno
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// unusedAddress returns TCP address on which nothing listens.
+func unusedAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	return address
+}
+
+// lineServer listens on address and sends received lines to returned
+// channel.
+func lineServer(t *testing.T, address string) (net.Listener, chan string) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := make(chan string, 1000)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					lines <- scanner.Text()
+				}
+			}()
+		}
+	}()
+	return listener, lines
+}
+
+// expectLines checks that lines with provided messages are received in order.
+func expectLines(t *testing.T, lines chan string, messages ...string) {
+	for _, message := range messages {
+		select {
+		case line := <-lines:
+			if line != message {
+				t.Fatalf("Expected line %q, got %q", message, line)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Line %q not received.", message)
+		}
+	}
+}
+
+func TestNetworkHandlerReplaysInOrder(t *testing.T) {
+	spool := filepath.Join(t.TempDir(), "spool")
+	address := unusedAddress(t)
+	h := NetworkHandlerOptions(NetworkOptions{
+		Network:    "tcp",
+		Address:    address,
+		Formatter:  messageFormat(),
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 20 * time.Millisecond,
+		BufferSize: 10,
+		SpoolFile:  spool,
+	})
+	defer h.(HandlerCloser).Close()
+
+	var messages []string
+	for i := 0; i < 20; i++ {
+		message := strconv.Itoa(i)
+		messages = append(messages, message)
+		// records handled before first connection fails are buffered
+		// without error
+		err := h.Handle(Record{Message: message})
+		if networkError, ok := err.(*NetworkError); err != nil && (!ok || !networkError.Buffered) {
+			t.Fatalf("Expected record to be buffered, got %v", err)
+		}
+	}
+	if info, err := os.Stat(spool); err != nil || info.Size() == 0 {
+		t.Fatalf("Expected records to be spooled: %v", err)
+	}
+
+	listener, lines := lineServer(t, address)
+	defer listener.Close()
+	expectLines(t, lines, messages...)
+	if err := h.Handle(Record{Message: "new"}); err != nil {
+		t.Fatalf("Unexpected error after reconnect: %v", err)
+	}
+	expectLines(t, lines, "new")
+}
+
+func TestNetworkHandlerDropsWhenFull(t *testing.T) {
+	h := NetworkHandlerOptions(NetworkOptions{
+		Network:    "tcp",
+		Address:    unusedAddress(t),
+		Formatter:  messageFormat(),
+		MinBackoff: time.Hour,
+		BufferSize: 4,
+	})
+	defer h.(HandlerCloser).Close()
+	if err := h.Handle(Record{Message: "abc"}); err != nil {
+		t.Errorf("Expected first record to be buffered while connecting, got %v", err)
+	}
+	if err, ok := h.Handle(Record{Message: "def"}).(*NetworkError); !ok || err.Buffered {
+		t.Errorf("Expected second record to be dropped, got %v", err)
+	}
+}
+
+func TestNetworkHandlerDoesNotWaitForDial(t *testing.T) {
+	// server accepts connections, but never completes TLS handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	h := NetworkHandlerOptions(NetworkOptions{
+		Network:    "tcp+tls",
+		Address:    listener.Addr().String(),
+		Formatter:  messageFormat(),
+		Timeout:    time.Second,
+		MinBackoff: time.Hour,
+	})
+	defer h.(HandlerCloser).Close()
+	// closing server first aborts handshake, so Close does not wait for it
+	defer listener.Close()
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		if err := h.Handle(Record{Message: "message"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected Handle not to wait for dial, took %s", elapsed)
+	}
+}
+
+func TestNetworkHandlerKeepsSpoolOnClose(t *testing.T) {
+	spool := filepath.Join(t.TempDir(), "spool")
+	address := unusedAddress(t)
+	options := NetworkOptions{
+		Network:    "tcp",
+		Address:    address,
+		Formatter:  messageFormat(),
+		MinBackoff: time.Hour,
+		SpoolFile:  spool,
+	}
+	h := NetworkHandlerOptions(options)
+	h.Handle(Record{Message: "first"})
+	h.Handle(Record{Message: "second"})
+	h.(HandlerCloser).Close()
+	if _, err := os.Stat(spool); err != nil {
+		t.Fatalf("Expected records to be moved to spool on close: %v", err)
+	}
+
+	listener, lines := lineServer(t, address)
+	defer listener.Close()
+	h = NetworkHandlerOptions(options)
+	if err := h.Handle(Record{Message: "third"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectLines(t, lines, "first", "second", "third")
+	h.(HandlerCloser).Close()
+	if _, err := os.Stat(spool); !os.IsNotExist(err) {
+		t.Errorf("Expected empty spool to be removed, got: %v", err)
+	}
+}
+
+func TestNetworkHandlerDefaultFormatter(t *testing.T) {
+	listener, lines := lineServer(t, "127.0.0.1:0")
+	defer listener.Close()
+	h := NetworkHandler("tcp", listener.Addr().String(), nil)
+	defer h.(HandlerCloser).Close()
+	if err := h.Handle(Record{Time: time.Now(), Level: INFO, Message: "message"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	select {
+	case line := <-lines:
+		if !strings.Contains(line, "msg=message") {
+			t.Errorf("Expected record in logfmt format, got %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Record not received.")
+	}
+}
@@ -0,0 +1,123 @@
+package ligno
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// OverflowPolicy defines what logger does with new record when its queue
+// of records waiting for processing is full.
+type OverflowPolicy uint8
+
+const (
+	// Block blocks caller until there is room in queue for new record.
+	// This is default policy.
+	Block OverflowPolicy = iota
+	// DropNewest discards record that is being logged if queue is full.
+	DropNewest
+	// DropOldest discards oldest record in queue to make room for record
+	// that is being logged.
+	DropOldest
+	// BlockWithTimeout blocks caller until there is room in queue for new
+	// record, but no longer then OverflowTimeout from logger options. If
+	// timeout expires, record that is being logged is discarded.
+	BlockWithTimeout
+)
+
+// DefaultOverflowTimeout is time logger with BlockWithTimeout policy waits
+// for room in queue if timeout is not set in options.
+const DefaultOverflowTimeout = 100 * time.Millisecond
+
+// droppedWarningDelay is max time that report about dropped records waits
+// for queue to drain.
+const droppedWarningDelay = time.Second
+
+// enqueue puts record to records queue respecting logger overflow policy.
+// Caller is responsible for incrementing number of records to process before
+// calling enqueue. If record is dropped, this is accounted for here.
+func (l *Logger) enqueue(record Record) {
+	switch l.overflowPolicy {
+	case DropNewest:
+		select {
+		case l.records <- record:
+		default:
+			l.recordDropped()
+		}
+	case DropOldest:
+		for {
+			select {
+			case l.records <- record:
+				return
+			default:
+			}
+			// make room by discarding oldest record in queue, it might have
+			// been taken by worker goroutine in the meantime, so just
+			// try again in that case.
+			select {
+			case <-l.records:
+				l.recordDropped()
+			default:
+			}
+		}
+	case BlockWithTimeout:
+		select {
+		case l.records <- record:
+			return
+		default:
+		}
+		timer := time.NewTimer(l.overflowTimeout)
+		defer timer.Stop()
+		select {
+		case l.records <- record:
+		case <-timer.C:
+			l.recordDropped()
+		}
+	default:
+		l.records <- record
+	}
+}
+
+// recordDropped updates counters when record is discarded because of
+// full queue.
+func (l *Logger) recordDropped() {
+	atomic.AddInt32(&l.toProcess, -1)
+	atomic.AddUint64(&l.dropped.total, 1)
+	atomic.AddUint64(&l.dropped.unreported, 1)
+	select {
+	case l.dropped.notify <- struct{}{}:
+	default:
+	}
+}
+
+// reportDropped processes synthetic warning record about records dropped
+// since last report, if there are any.
+func (l *Logger) reportDropped() {
+	if warning, warn := l.droppedRecordsWarning(); warn {
+		warning.Context = l.buildContext().merge(warning.Context)
+		l.process(warning)
+	}
+}
+
+// droppedRecordsWarning returns synthetic record that reports number of
+// records dropped since last report. If no records were dropped, false
+// is returned as second value.
+func (l *Logger) droppedRecordsWarning() (Record, bool) {
+	dropped := atomic.SwapUint64(&l.dropped.unreported, 0)
+	if dropped == 0 {
+		return Record{}, false
+	}
+	return Record{
+		Time:       time.Now().UTC(),
+		Level:      WARNING,
+		Message:    "Records dropped because logger queue was full.",
+		Context:    Ctx{"dropped": dropped},
+		Logger:     l,
+		LoggerName: l.fullName,
+	}, true
+}
+
+// Dropped returns total number of records that this logger discarded
+// because its queue was full.
+func (l *Logger) Dropped() uint64 {
+	return atomic.LoadUint64(&l.core().dropped.total)
+}
@@ -35,5 +35,13 @@ func (bp *byteBufferPool) Put(buff *bytes.Buffer) {
 	bp.Pool.Put(buff)
 }
 
+// bytes returns copy of content of provided buffer, so that buffer can be
+// returned to pool while content is still in use.
+func (bp *byteBufferPool) bytes(buff *bytes.Buffer) []byte {
+	content := make([]byte, buff.Len())
+	copy(content, buff.Bytes())
+	return content
+}
+
 // buffPool is single instance of buffer pool.
 var buffPool = newByteBufferPool()
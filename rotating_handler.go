@@ -0,0 +1,351 @@
+package ligno
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotationInterval defines time boundary on which rotating file handler
+// rotates file regardless of its size.
+type RotationInterval uint8
+
+const (
+	// RotateNever disables time based rotation.
+	RotateNever RotationInterval = iota
+	// RotateHourly rotates file at beginning of every hour.
+	RotateHourly
+	// RotateDaily rotates file at midnight.
+	RotateDaily
+)
+
+// backupTimeFormat is format of timestamp added to names of rotated files.
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotatingFileOptions is container for configuration of rotating file handler.
+// Empty value is valid, but it never rotates file.
+type RotatingFileOptions struct {
+	// MaxSize is size in bytes after which file is rotated. Zero disables
+	// size based rotation.
+	MaxSize int64
+	// Interval is time boundary on which file is rotated.
+	Interval RotationInterval
+	// MaxBackups is number of rotated files to keep. Zero keeps all of them.
+	MaxBackups int
+	// Compress is flag that indicates if rotated files should be gzipped.
+	Compress bool
+}
+
+// timeNow returns current time. It is variable so that tests can control time.
+var timeNow = time.Now
+
+// rotatingFiles holds all files opened by rotating file handlers, keyed by
+// absolute path, so that handlers writing to same path share single file.
+var rotatingFiles = struct {
+	sync.Mutex
+	files map[string]*rotatingFile
+}{files: make(map[string]*rotatingFile)}
+
+// rotatingFile is file on disk shared by all rotating handlers that write
+// to same path.
+type rotatingFile struct {
+	mu           sync.Mutex
+	fileName     string
+	options      RotatingFileOptions
+	f            *os.File
+	size         int64
+	nextRotation time.Time
+	// refs is number of handlers using this file.
+	refs int
+}
+
+// acquireRotatingFile returns shared rotating file for provided path,
+// creating it if needed. Options are used only when file is created.
+func acquireRotatingFile(fileName string, options RotatingFileOptions) *rotatingFile {
+	if abs, err := filepath.Abs(fileName); err == nil {
+		fileName = abs
+	}
+	rotatingFiles.Lock()
+	defer rotatingFiles.Unlock()
+	rf, ok := rotatingFiles.files[fileName]
+	if !ok {
+		rf = &rotatingFile{
+			fileName: fileName,
+			options:  options,
+		}
+		rotatingFiles.files[fileName] = rf
+	}
+	rf.refs++
+	return rf
+}
+
+// release decrements number of handlers using file and closes it when last
+// handler is done with it.
+func (rf *rotatingFile) release() {
+	rotatingFiles.Lock()
+	defer rotatingFiles.Unlock()
+	rf.refs--
+	if rf.refs > 0 {
+		return
+	}
+	delete(rotatingFiles.files, rf.fileName)
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.f != nil {
+		rf.f.Close()
+		rf.f = nil
+	}
+}
+
+// write writes provided data to file, rotating it first if needed. If
+// compressing or removing backups fails during rotation, data is still
+// written to new file and that error is returned.
+func (rf *rotatingFile) write(data []byte) error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.f == nil {
+		if err := rf.open(); err != nil {
+			return err
+		}
+	}
+	var cleanupErr error
+	if rf.shouldRotate(len(data)) {
+		backup, err := rf.rotate()
+		if err != nil {
+			return err
+		}
+		cleanupErr = rf.cleanup(backup)
+	}
+	n, err := rf.f.Write(data)
+	rf.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return cleanupErr
+}
+
+// open opens file for appending and initializes size and time of next rotation.
+func (rf *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(rf.fileName), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(rf.fileName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.f = f
+	rf.size = info.Size()
+	rf.nextRotation = nextRotation(timeNow(), rf.options.Interval)
+	return nil
+}
+
+// shouldRotate returns true if file has to be rotated before writing
+// provided number of bytes.
+func (rf *rotatingFile) shouldRotate(n int) bool {
+	if rf.options.MaxSize > 0 && rf.size > 0 && rf.size+int64(n) > rf.options.MaxSize {
+		return true
+	}
+	return rf.options.Interval != RotateNever && !timeNow().Before(rf.nextRotation)
+}
+
+// rotate closes current file, moves it to backup location and opens new
+// file. It returns name of backup.
+func (rf *rotatingFile) rotate() (string, error) {
+	if err := rf.f.Close(); err != nil {
+		return "", err
+	}
+	rf.f = nil
+	// make sure that existing backup is not overwritten if file is rotated
+	// more then once in same millisecond.
+	t := timeNow()
+	backup := rf.backupName(t)
+	for fileExists(backup) || fileExists(backup+".gz") {
+		t = t.Add(time.Millisecond)
+		backup = rf.backupName(t)
+	}
+	if err := os.Rename(rf.fileName, backup); err != nil {
+		return "", err
+	}
+	return backup, rf.open()
+}
+
+// cleanup compresses provided backup if needed and removes old backups.
+func (rf *rotatingFile) cleanup(backup string) error {
+	if rf.options.Compress {
+		if err := compressFile(backup); err != nil {
+			return err
+		}
+	}
+	return rf.removeOldBackups()
+}
+
+// backupName returns name for rotated file based on provided time.
+// For file "app.log" it returns something like "app-2006-01-02T15-04-05.000.log".
+func (rf *rotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(rf.fileName)
+	prefix := strings.TrimSuffix(rf.fileName, ext)
+	return prefix + "-" + t.Format(backupTimeFormat) + ext
+}
+
+// backups returns all existing backups of file, oldest first.
+func (rf *rotatingFile) backups() ([]string, error) {
+	dir := filepath.Dir(rf.fileName)
+	ext := filepath.Ext(rf.fileName)
+	prefix := strings.TrimSuffix(filepath.Base(rf.fileName), ext) + "-"
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	type backup struct {
+		name string
+		t    time.Time
+	}
+	var found []backup
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimPrefix(name, prefix)
+		stamp = strings.TrimSuffix(stamp, ".gz")
+		if !strings.HasSuffix(stamp, ext) {
+			continue
+		}
+		stamp = strings.TrimSuffix(stamp, ext)
+		t, err := time.Parse(backupTimeFormat, stamp)
+		if err != nil {
+			continue
+		}
+		found = append(found, backup{name: filepath.Join(dir, name), t: t})
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].t.Before(found[j].t)
+	})
+	backups := make([]string, 0, len(found))
+	for _, b := range found {
+		backups = append(backups, b.name)
+	}
+	return backups, nil
+}
+
+// removeOldBackups removes oldest backups so that at most MaxBackups remain.
+func (rf *rotatingFile) removeOldBackups() error {
+	if rf.options.MaxBackups <= 0 {
+		return nil
+	}
+	backups, err := rf.backups()
+	if err != nil {
+		return err
+	}
+	for len(backups) > rf.options.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// nextRotation returns first time boundary after provided time for
+// provided interval.
+func nextRotation(t time.Time, interval RotationInterval) time.Time {
+	switch interval {
+	case RotateHourly:
+		return t.Truncate(time.Hour).Add(time.Hour)
+	case RotateDaily:
+		year, month, day := t.Date()
+		return time.Date(year, month, day+1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Time{}
+	}
+}
+
+// fileExists returns true if file with provided name exists.
+func fileExists(fileName string) bool {
+	_, err := os.Stat(fileName)
+	return err == nil
+}
+
+// compressFile gzips file with provided name and removes original.
+func compressFile(fileName string) error {
+	src, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(fileName+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		gz.Close()
+		dst.Close()
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(fileName)
+}
+
+// rotatingFileHandler writes records to file that is rotated based on
+// its size and time.
+type rotatingFileHandler struct {
+	file      *rotatingFile
+	formatter Formatter
+	mu        sync.RWMutex
+	closed    bool
+}
+
+// RotatingFileHandler returns handler that writes records to file with
+// provided name and rotates it when it reaches max size or time boundary
+// defined in options. Rotated files get timestamp in their name.
+// Multiple handlers can write to same path, in which case they share
+// single file and options of first created handler are used.
+func RotatingFileHandler(fileName string, formatter Formatter, options RotatingFileOptions) Handler {
+	return &rotatingFileHandler{
+		file:      acquireRotatingFile(fileName, options),
+		formatter: formatter,
+	}
+}
+
+// Handle writes record to file, rotating it if needed.
+func (h *rotatingFileHandler) Handle(record Record) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.closed {
+		return errHandlerClosed
+	}
+	return h.file.write(h.formatter.Format(record))
+}
+
+// Close releases file. File is closed once all handlers that use it
+// are closed. Records handled after Close are not written.
+func (h *rotatingFileHandler) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	h.closed = true
+	h.file.release()
+}
@@ -0,0 +1,149 @@
+package ligno
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func messageFormat() Formatter {
+	return FormatterFunc(func(record Record) []byte {
+		return []byte(record.Message + "\n")
+	})
+}
+
+func TestRotatingFileHandlerMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "app.log")
+	h := RotatingFileHandler(fileName, messageFormat(), RotatingFileOptions{
+		MaxSize:    10,
+		MaxBackups: 2,
+	})
+	defer h.(HandlerCloser).Close()
+	for _, msg := range []string{"first", "second", "third", "fourth"} {
+		if err := h.Handle(Record{Message: msg}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "fourth\n" {
+		t.Errorf("Unexpected content of current file: %q", content)
+	}
+	backups, err := filepath.Glob(filepath.Join(dir, "app-*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 backups, found %d: %v", len(backups), backups)
+	}
+	oldest, _ := ioutil.ReadFile(backups[0])
+	if string(oldest) != "second\n" {
+		t.Errorf("Expected oldest kept backup to contain second message, got %q", oldest)
+	}
+}
+
+func TestRotatingFileHandlerInterval(t *testing.T) {
+	current := time.Date(2016, 1, 1, 10, 30, 0, 0, time.UTC)
+	timeNow = func() time.Time { return current }
+	defer func() { timeNow = time.Now }()
+
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "app.log")
+	h := RotatingFileHandler(fileName, messageFormat(), RotatingFileOptions{
+		Interval: RotateHourly,
+		Compress: true,
+	})
+	defer h.(HandlerCloser).Close()
+	h.Handle(Record{Message: "before"})
+	current = current.Add(time.Hour)
+	h.Handle(Record{Message: "after"})
+
+	backup := filepath.Join(dir, "app-2016-01-01T11-30-00.000.log.gz")
+	f, err := os.Open(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "before\n" {
+		t.Errorf("Unexpected content of rotated file: %q", content)
+	}
+}
+
+func TestRotatingFileHandlerSharedPath(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "shared.log")
+	options := RotatingFileOptions{MaxSize: 1024}
+	h1 := RotatingFileHandler(fileName, messageFormat(), options)
+	h2 := RotatingFileHandler(fileName, messageFormat(), options)
+	if h1.(*rotatingFileHandler).file != h2.(*rotatingFileHandler).file {
+		t.Fatal("Expected handlers to share same file.")
+	}
+	h1.Handle(Record{Message: "one"})
+	h1.(HandlerCloser).Close()
+	if err := h2.Handle(Record{Message: "two"}); err != nil {
+		t.Fatal(err)
+	}
+	h2.(HandlerCloser).Close()
+	content, _ := ioutil.ReadFile(fileName)
+	if strings.Count(string(content), "\n") != 2 {
+		t.Errorf("Expected two lines in file, got %q", content)
+	}
+}
+
+func TestRotatingFileHandlerCleanupError(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "app.log")
+	// backup that can not be removed, because it is non empty directory
+	stale := filepath.Join(dir, "app-2000-01-01T00-00-00.000.log")
+	if err := os.MkdirAll(filepath.Join(stale, "keep"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	h := RotatingFileHandler(fileName, messageFormat(), RotatingFileOptions{
+		MaxSize:    10,
+		MaxBackups: 1,
+	})
+	defer h.(HandlerCloser).Close()
+	if err := h.Handle(Record{Message: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Handle(Record{Message: "second"}); err == nil {
+		t.Error("Expected error when old backup can not be removed.")
+	}
+	content, _ := ioutil.ReadFile(fileName)
+	if string(content) != "second\n" {
+		t.Errorf("Expected record to be written after failed cleanup, got %q", content)
+	}
+}
+
+func TestRotatingFileHandlerClosed(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "app.log")
+	h := RotatingFileHandler(fileName, messageFormat(), RotatingFileOptions{})
+	h.Handle(Record{Message: "first"})
+	h.(HandlerCloser).Close()
+	if err := h.Handle(Record{Message: "second"}); err != errHandlerClosed {
+		t.Errorf("Expected errHandlerClosed, got %v", err)
+	}
+	if f := h.(*rotatingFileHandler).file.f; f != nil {
+		t.Error("Expected file to stay closed.")
+	}
+	content, _ := ioutil.ReadFile(fileName)
+	if string(content) != "first\n" {
+		t.Errorf("Unexpected content of file: %q", content)
+	}
+}
@@ -0,0 +1,133 @@
+package ligno
+
+import "strings"
+
+// RoutingMode defines how routing handler picks handlers for record.
+type RoutingMode uint8
+
+const (
+	// FirstMatch passes record only to handler of first route that matches it.
+	FirstMatch RoutingMode = iota
+	// AllMatch passes record to handlers of all routes that match it.
+	AllMatch
+)
+
+// Route is single rule of routing handler. Records for which predicate
+// returns true are passed to handler.
+type Route struct {
+	Predicate Predicate
+	Handler   Handler
+}
+
+// LevelRangePredicate returns predicate that accepts records with level
+// between min and max, inclusive. If max is NOTSET, there is no upper bound.
+func LevelRangePredicate(min, max Level) Predicate {
+	return func(record Record) bool {
+		return record.Level >= min && (max == NOTSET || record.Level <= max)
+	}
+}
+
+// LoggerPrefixPredicate returns predicate that accepts records created by
+// logger with provided full name or any of its descendants. For example,
+// prefix "db" accepts records from loggers "db" and "db.pool", but not
+// from "dbx". Empty prefix accepts all records.
+func LoggerPrefixPredicate(prefix string) Predicate {
+	return func(record Record) bool {
+		if prefix == "" {
+			return true
+		}
+		name := record.LoggerName
+		return name == prefix || strings.HasPrefix(name, prefix+".")
+	}
+}
+
+// LevelRoute returns route that passes records with level between min
+// and max (inclusive) to provided handler. If max is NOTSET, there is no
+// upper bound.
+func LevelRoute(min, max Level, handler Handler) Route {
+	return Route{Predicate: LevelRangePredicate(min, max), Handler: handler}
+}
+
+// LoggerPrefixRoute returns route that passes records from logger with
+// provided name and its descendants to provided handler.
+func LoggerPrefixRoute(prefix string, handler Handler) Route {
+	return Route{Predicate: LoggerPrefixPredicate(prefix), Handler: handler}
+}
+
+// routingHandler passes records to handlers based on routes.
+type routingHandler struct {
+	mode   RoutingMode
+	routes []Route
+}
+
+// RoutingHandler creates handler that passes records to handlers of
+// routes that match them. Routes are checked in order in which they are
+// provided and mode defines if only first matching route is used or all
+// of them. Example:
+//
+//	RoutingHandler(AllMatch,
+//	    LevelRoute(DEBUG, INFO, fileHandler),
+//	    LevelRoute(WARNING, NOTSET, stderrHandler),
+//	    LevelRoute(CRITICAL, NOTSET, syslogHandler),
+//	)
+func RoutingHandler(mode RoutingMode, routes ...Route) Handler {
+	return &routingHandler{
+		mode:   mode,
+		routes: routes,
+	}
+}
+
+// Handle passes record to handlers of matching routes. If some of them
+// fail, returned error is MultiError with HandlerError for each of them,
+// where index is position of route.
+func (rh *routingHandler) Handle(record Record) error {
+	var errs []error
+	for i, route := range rh.routes {
+		if !route.Predicate(record) {
+			continue
+		}
+		if err := route.Handler.Handle(record); err != nil {
+			if errs == nil {
+				errs = make([]error, len(rh.routes))
+			}
+			errs[i] = err
+		}
+		if rh.mode == FirstMatch {
+			break
+		}
+	}
+	if errs == nil {
+		return nil
+	}
+	return combineErrors(rh.handlers(), errs)
+}
+
+// handlers returns handlers of all routes, in order of routes.
+func (rh *routingHandler) handlers() []Handler {
+	handlers := make([]Handler, 0, len(rh.routes))
+	for _, route := range rh.routes {
+		handlers = append(handlers, route.Handler)
+	}
+	return handlers
+}
+
+// Flush flushes handlers of all routes that implement Flusher.
+func (rh *routingHandler) Flush() error {
+	return flushHandlers(rh.handlers())
+}
+
+// Close closes handlers of all routes that implement HandlerCloser.
+// Handler used in multiple routes is closed only once.
+func (rh *routingHandler) Close() {
+	closeHandlersOnce(rh.handlers())
+}
+
+// closeNested is implementation of nestedCloser interface.
+func (rh *routingHandler) closeNested(closed map[Handler]bool) {
+	closeHandlersIn(rh.handlers(), closed)
+}
+
+// wrapped is implementation of nestedCloser interface.
+func (rh *routingHandler) wrapped() []Handler {
+	return rh.handlers()
+}
@@ -0,0 +1,149 @@
+package ligno
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ShutdownError is returned by Shutdown when context is done before all
+// loggers processed their records.
+type ShutdownError struct {
+	// Pending holds number of records that were not processed, keyed by
+	// full name of logger. Root logger has empty name.
+	Pending map[string]int
+	// Err is error of context that interrupted shutdown.
+	Err error
+}
+
+// Error is implementation of error interface.
+func (se *ShutdownError) Error() string {
+	names := make([]string, 0, len(se.Pending))
+	for name := range se.Pending {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pending := make([]string, 0, len(names))
+	for _, name := range names {
+		pending = append(pending, fmt.Sprintf("%q: %d", name, se.Pending[name]))
+	}
+	return fmt.Sprintf("shutdown interrupted: %v, pending records: %s", se.Err, strings.Join(pending, ", "))
+}
+
+// Unwrap returns error of context that interrupted shutdown.
+func (se *ShutdownError) Unwrap() error {
+	return se.Err
+}
+
+// Shutdown stops all loggers, waiting for them to process queued records,
+// and closes their handlers. See Logger.Shutdown.
+func Shutdown(ctx context.Context) error {
+	return rootLogger.Shutdown(ctx)
+}
+
+// Shutdown stops this logger and all its descendants. Loggers are stopped
+// bottom-up, so that every logger is stopped only after all loggers that
+// propagate records to it are stopped and their records are processed.
+// Once all loggers are stopped, their handlers are closed, each handler
+// only once even if multiple loggers use it or it is wrapped by handlers
+// like CombiningHandler.
+// If context is done before all records are processed, remaining loggers
+// are stopped without waiting and their handlers are not closed (since they
+// might still be in use). Handlers of loggers that processed all records are
+// closed, unless remaining loggers use them too, and returned error is
+// *ShutdownError that holds number of pending records per logger.
+func (l *Logger) Shutdown(ctx context.Context) error {
+	var loggers []*Logger
+	l.core().walk(func(logger *Logger) {
+		loggers = append(loggers, logger)
+	})
+
+	// walk visits parents first, so loggers are stopped in reverse order
+	for i := len(loggers) - 1; i >= 0; i-- {
+		var finished bool
+		loggers[i].stop(func() {
+			finished = loggers[i].waitContext(ctx)
+		})
+		if finished {
+			continue
+		}
+		pending := make(map[string]int)
+		for _, logger := range loggers[:i+1] {
+			logger.stop(func() {})
+			if n := logger.QueueLength(); n > 0 {
+				pending[logger.fullName] = n
+			}
+		}
+		inUse := make(map[Handler]bool)
+		markHandlersIn(loggerHandlers(loggers[:i+1]), inUse)
+		closeHandlersIn(loggerHandlers(loggers[i+1:]), inUse)
+		return &ShutdownError{Pending: pending, Err: ctx.Err()}
+	}
+
+	closeHandlersOnce(loggerHandlers(loggers))
+	return nil
+}
+
+// loggerHandlers returns handlers of provided loggers.
+func loggerHandlers(loggers []*Logger) []Handler {
+	handlers := make([]Handler, 0, len(loggers))
+	for _, logger := range loggers {
+		handlers = append(handlers, logger.Handler())
+	}
+	return handlers
+}
+
+// ShutdownOnSignal starts listening for provided signals (SIGINT and SIGTERM
+// if none are provided) and when signal arrives, shuts down all loggers
+// (see Shutdown), waiting at most provided timeout for them. Once loggers
+// are shut down, signal is delivered again, so that application terminates
+// as it would without this helper. Returned function stops listening for
+// signals.
+func ShutdownOnSignal(timeout time.Duration, signals ...os.Signal) (stop func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, signals...)
+	go func() {
+		select {
+		case sig := <-ch:
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			if err := Shutdown(ctx); err != nil {
+				fmt.Fprintf(os.Stderr, "ligno: %v\n", err)
+			}
+			signal.Stop(ch)
+			if process, err := os.FindProcess(os.Getpid()); err != nil || process.Signal(sig) != nil {
+				os.Exit(1)
+			}
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
+
+// waitContext blocks until all records sent to logger are processed or
+// context is done. It returns true if all records are processed, in which
+// case handlers are flushed, same as in Wait.
+func (l *Logger) waitContext(ctx context.Context) bool {
+	done := make(chan struct{})
+	// handler might be stuck, so even notifying worker must not block
+	go l.wait(done)
+	select {
+	case <-done:
+		l.flush()
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,114 @@
+package ligno
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestShutdownStopsChildrenFirst(t *testing.T) {
+	shared := &countingCloser{}
+	memory := MemoryHandler(messageFormat())
+	parent := GetLoggerOptions("shutdown."+randString(), LoggerOptions{
+		Handler:            CombiningHandler(memory, shared),
+		PreventPropagation: true,
+	})
+	child := parent.SubLoggerOptions("child", LoggerOptions{Handler: shared})
+	grandchild := child.SubLoggerOptions("grandchild", LoggerOptions{Handler: shared})
+	for i := 0; i < 100; i++ {
+		grandchild.Info("message")
+	}
+
+	if err := parent.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if messages := memory.Messages(); len(messages) != 100 {
+		t.Errorf("Expected 100 propagated records, got %d", len(messages))
+	}
+	for _, l := range []*Logger{parent, child, grandchild} {
+		if l.IsRunning() {
+			t.Errorf("Expected logger %s to be stopped.", l.FullName())
+		}
+	}
+	if shared.closed != 1 {
+		t.Errorf("Expected shared handler to be closed once, got %d", shared.closed)
+	}
+}
+
+func TestWaitAfterShutdown(t *testing.T) {
+	l := GetLoggerOptions("shutdown."+randString(), LoggerOptions{
+		Handler:            NullHandler(),
+		PreventPropagation: true,
+	})
+	l.Info("message")
+	if err := l.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !l.WaitTimeout(time.Second) {
+		t.Error("Expected wait on stopped logger to return.")
+	}
+	l.Wait()
+	l.StopAndWait()
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	l := GetLoggerOptions("shutdown."+randString(), LoggerOptions{
+		Handler: HandlerFunc(func(Record) error {
+			<-release
+			return nil
+		}),
+		PreventPropagation: true,
+	})
+	l.Info("first")
+	l.Info("second")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := l.Shutdown(ctx)
+	var shutdownErr *ShutdownError
+	if !errors.As(err, &shutdownErr) {
+		t.Fatalf("Expected ShutdownError, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline error, got %v", shutdownErr.Err)
+	}
+	if pending := shutdownErr.Pending[l.FullName()]; pending != 2 {
+		t.Errorf("Expected 2 pending records, got %v", shutdownErr.Pending)
+	}
+}
+
+func TestShutdownDeadlineClosesDrainedHandlers(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	shared := &countingCloser{}
+	parent := GetLoggerOptions("shutdown."+randString(), LoggerOptions{
+		Handler: CombiningHandler(shared, HandlerFunc(func(Record) error {
+			<-release
+			return nil
+		})),
+		PreventPropagation: true,
+	})
+	drained := &countingCloser{}
+	child := parent.SubLoggerOptions("child", LoggerOptions{
+		Handler:            CombiningHandler(drained, shared),
+		PreventPropagation: true,
+	})
+	child.Info("message")
+	parent.Info("message")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var shutdownErr *ShutdownError
+	if err := parent.Shutdown(ctx); !errors.As(err, &shutdownErr) {
+		t.Fatalf("Expected ShutdownError, got %v", err)
+	}
+	if drained.closed != 1 {
+		t.Errorf("Expected handler of drained logger to be closed once, got %d", drained.closed)
+	}
+	if shared.closed != 0 {
+		t.Errorf("Expected handler used by pending logger not to be closed, got %d", shared.closed)
+	}
+}
@@ -0,0 +1,36 @@
+package ligno
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// ReopenOnSignal starts listening for provided signals (SIGHUP if none are
+// provided) and reopens all file handlers when signal arrives. This is
+// intended for cooperation with external log rotation tools, like logrotate.
+// Returned function stops listening for signals.
+func ReopenOnSignal(signals ...os.Signal) (stop func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGHUP}
+	}
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, signals...)
+	go func() {
+		for {
+			select {
+			case <-ch:
+				if err := ReopenFileHandlers(); err != nil {
+					rootLogger.Error("Unable to reopen log files.", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
@@ -0,0 +1,187 @@
+//go:build go1.21
+
+package ligno
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"sort"
+	"time"
+)
+
+// LevelFromSlog returns ligno level that corresponds to provided slog level.
+// Levels between slog levels are mapped to nearest lower ligno level and
+// levels above slog.LevelError are mapped to CRITICAL.
+func LevelFromSlog(level slog.Level) Level {
+	switch {
+	case level < slog.LevelInfo:
+		return DEBUG
+	case level < slog.LevelWarn:
+		return INFO
+	case level < slog.LevelError:
+		return WARNING
+	case level == slog.LevelError:
+		return ERROR
+	default:
+		return CRITICAL
+	}
+}
+
+// SlogLevel returns slog level that corresponds to provided ligno level.
+// CRITICAL is mapped to level above slog.LevelError.
+func SlogLevel(level Level) slog.Level {
+	switch {
+	case level < INFO:
+		return slog.LevelDebug
+	case level < WARNING:
+		return slog.LevelInfo
+	case level < ERROR:
+		return slog.LevelWarn
+	case level < CRITICAL:
+		return slog.LevelError
+	default:
+		return slog.LevelError + 4
+	}
+}
+
+// slogAdapter is slog.Handler that logs records with ligno logger.
+type slogAdapter struct {
+	logger *Logger
+	// prefix is prepended to keys of attributes, it holds names of open
+	// groups separated by ".".
+	prefix string
+}
+
+// SlogAdapter returns slog.Handler that logs records with provided logger,
+// so that code using log/slog writes to ligno handlers. Attributes are
+// added to record context, where keys of attributes in groups are prefixed
+// with group names separated by ".". Values of registered context keys
+// (see RegisterContextKey) are added too.
+func SlogAdapter(l *Logger) slog.Handler {
+	return &slogAdapter{logger: l}
+}
+
+// Slog returns slog.Logger that logs records with this logger.
+func (l *Logger) Slog() *slog.Logger {
+	return slog.New(SlogAdapter(l))
+}
+
+// Enabled is implementation of slog.Handler interface.
+func (sa *slogAdapter) Enabled(_ context.Context, level slog.Level) bool {
+	return sa.logger.IsEnabledFor(LevelFromSlog(level))
+}
+
+// Handle is implementation of slog.Handler interface.
+func (sa *slogAdapter) Handle(ctx context.Context, r slog.Record) error {
+	data := make(Ctx, r.NumAttrs())
+	r.Attrs(func(attr slog.Attr) bool {
+		addSlogAttr(data, sa.prefix, attr)
+		return true
+	})
+	record := Record{
+		Time:       r.Time.UTC(),
+		Level:      LevelFromSlog(r.Level),
+		Message:    r.Message,
+		Context:    addContextValues(ctx, data),
+		Logger:     sa.logger,
+		LoggerName: sa.logger.fullName,
+	}
+	if r.Time.IsZero() {
+		record.Time = time.Now().UTC()
+	}
+	if r.PC != 0 && sa.logger.core().includeFileAndLine {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		record.File = frame.File
+		record.Line = frame.Line
+	}
+	// caller is already known from slog record, so calldepth is not needed
+	sa.logger.log(0, record)
+	return nil
+}
+
+// WithAttrs is implementation of slog.Handler interface. Attributes are
+// added to context of derived logger (see Logger.With).
+func (sa *slogAdapter) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return sa
+	}
+	data := make(Ctx, len(attrs))
+	for _, attr := range attrs {
+		addSlogAttr(data, sa.prefix, attr)
+	}
+	return &slogAdapter{
+		logger: sa.logger.WithCtx(data),
+		prefix: sa.prefix,
+	}
+}
+
+// WithGroup is implementation of slog.Handler interface.
+func (sa *slogAdapter) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return sa
+	}
+	return &slogAdapter{
+		logger: sa.logger,
+		prefix: sa.prefix + name + ".",
+	}
+}
+
+// addSlogAttr adds attribute to context, with key prefixed with provided
+// prefix. Groups are flattened according to slog rules: empty attributes
+// and empty groups are ignored and attributes of group with empty key are
+// added as if they were not in group.
+func addSlogAttr(data Ctx, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+	if attr.Value.Kind() != slog.KindGroup {
+		data[prefix+attr.Key] = attr.Value.Any()
+		return
+	}
+	if attr.Key != "" {
+		prefix += attr.Key + "."
+	}
+	for _, groupAttr := range attr.Value.Group() {
+		addSlogAttr(data, prefix, groupAttr)
+	}
+}
+
+// slogHandler is ligno handler that passes records to slog.Handler.
+type slogHandler struct {
+	handler slog.Handler
+}
+
+// SlogHandler returns handler that passes records to provided slog.Handler,
+// so that ligno loggers can write to slog handlers. Context of record is
+// passed as attributes, sorted by key, preceded by logger name (under key
+// "logger") and file and line (under keys "file" and "line") if they are set.
+func SlogHandler(handler slog.Handler) Handler {
+	return &slogHandler{handler: handler}
+}
+
+// Handle is implementation of Handler interface.
+func (sh *slogHandler) Handle(record Record) error {
+	ctx := context.Background()
+	level := SlogLevel(record.Level)
+	if !sh.handler.Enabled(ctx, level) {
+		return nil
+	}
+	r := slog.NewRecord(record.Time, level, record.Message, 0)
+	if record.LoggerName != "" {
+		r.AddAttrs(slog.String("logger", record.LoggerName))
+	}
+	if record.File != "" {
+		r.AddAttrs(slog.String("file", record.File), slog.Int("line", record.Line))
+	}
+	keys := make([]string, 0, len(record.Context))
+	for key := range record.Context {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		r.AddAttrs(slog.Any(key, record.Context[key]))
+	}
+	return sh.handler.Handle(ctx, r)
+}
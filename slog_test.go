@@ -0,0 +1,66 @@
+//go:build go1.21
+
+package ligno
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestSlogLevels(t *testing.T) {
+	for _, level := range []Level{DEBUG, INFO, WARNING, ERROR, CRITICAL} {
+		if got := LevelFromSlog(SlogLevel(level)); got != level {
+			t.Errorf("Expected level %s after round trip, got %s", level, got)
+		}
+	}
+	if got := LevelFromSlog(slog.LevelInfo + 2); got != INFO {
+		t.Errorf("Expected level between slog levels to map to INFO, got %s", got)
+	}
+}
+
+func TestSlogAdapter(t *testing.T) {
+	memory := MemoryHandler(contextFormat())
+	l := GetLoggerOptions("slog."+randString(), LoggerOptions{
+		Handler:            memory,
+		Level:              INFO,
+		PreventPropagation: true,
+	})
+	logger := l.Slog().With("a", 1).WithGroup("g").With("b", 2)
+	logger.Debug("filtered")
+	logger.Info("message", "c", 3, slog.Group("h", "d", 4), slog.Group("empty"))
+	l.Wait()
+
+	expected := "message a=1 g.b=2 g.c=3 g.h.d=4"
+	if messages := memory.Messages(); len(messages) != 1 || messages[0] != expected {
+		t.Errorf("Expected message %q, got %v", expected, messages)
+	}
+	l.StopAndWait()
+}
+
+func TestSlogHandler(t *testing.T) {
+	out := new(bytes.Buffer)
+	h := SlogHandler(slog.NewTextHandler(out, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	}))
+	h.Handle(Record{Time: time.Now(), Level: DEBUG, Message: "filtered"})
+	h.Handle(Record{
+		Time:       time.Now(),
+		Level:      WARNING,
+		Message:    "message",
+		LoggerName: "app.db",
+		Context:    Ctx{"b": 2, "a": 1},
+	})
+
+	expected := "level=WARN msg=message logger=app.db a=1 b=2\n"
+	if out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+}
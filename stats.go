@@ -0,0 +1,238 @@
+package ligno
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// levelCounters counts records per level. Since levels can be added at
+// runtime, counters are created lazily.
+type levelCounters struct {
+	counters sync.Map
+}
+
+// inc increments counter for provided level.
+func (lc *levelCounters) inc(level Level) {
+	counter, ok := lc.counters.Load(level)
+	if !ok {
+		counter, _ = lc.counters.LoadOrStore(level, new(uint64))
+	}
+	atomic.AddUint64(counter.(*uint64), 1)
+}
+
+// snapshot returns current values of all counters.
+func (lc *levelCounters) snapshot() map[Level]uint64 {
+	values := make(map[Level]uint64)
+	lc.counters.Range(func(key, value interface{}) bool {
+		values[key.(Level)] = atomic.LoadUint64(value.(*uint64))
+		return true
+	})
+	return values
+}
+
+// Stats is snapshot of logger metrics.
+type Stats struct {
+	// Logged is number of records logged with logger, per level.
+	Logged map[Level]uint64 `json:"logged"`
+	// Filtered is number of records discarded because logger is not
+	// enabled for their level, per level.
+	Filtered map[Level]uint64 `json:"filtered"`
+	// Dropped is number of records discarded because queue was full.
+	Dropped uint64 `json:"dropped"`
+	// Handled is number of records passed to handler.
+	Handled uint64 `json:"handled"`
+	// HandlerErrors is number of records for which handler returned error.
+	// If batch handler fails, all records of batch are counted.
+	HandlerErrors uint64 `json:"handler_errors"`
+	// HandleTime is total time spent in handler.
+	HandleTime time.Duration `json:"handle_time"`
+	// QueueLength is number of records waiting for handler.
+	QueueLength int `json:"queue_length"`
+	// QueueCapacity is capacity of queue of records waiting for handler.
+	QueueCapacity int `json:"queue_capacity"`
+}
+
+// AverageHandleLatency returns average time handler needed to process record.
+func (s Stats) AverageHandleLatency() time.Duration {
+	if s.Handled == 0 {
+		return 0
+	}
+	return s.HandleTime / time.Duration(s.Handled)
+}
+
+// add adds all values from other stats to this one.
+func (s *Stats) add(other Stats) {
+	for level, count := range other.Logged {
+		s.Logged[level] += count
+	}
+	for level, count := range other.Filtered {
+		s.Filtered[level] += count
+	}
+	s.Dropped += other.Dropped
+	s.Handled += other.Handled
+	s.HandlerErrors += other.HandlerErrors
+	s.HandleTime += other.HandleTime
+	s.QueueLength += other.QueueLength
+	s.QueueCapacity += other.QueueCapacity
+}
+
+// Stats returns snapshot of metrics of this logger.
+func (l *Logger) Stats() Stats {
+	l = l.core()
+	return Stats{
+		Logged:        l.stats.logged.snapshot(),
+		Filtered:      l.stats.filtered.snapshot(),
+		Dropped:       l.Dropped(),
+		Handled:       atomic.LoadUint64(&l.stats.handled),
+		HandlerErrors: atomic.LoadUint64(&l.stats.handlerErrors),
+		HandleTime:    time.Duration(atomic.LoadUint64(&l.stats.handleNanos)),
+		QueueLength:   len(l.records),
+		QueueCapacity: cap(l.records),
+	}
+}
+
+// TreeStats returns sum of metrics of this logger and all its descendants.
+func (l *Logger) TreeStats() Stats {
+	stats := Stats{
+		Logged:   make(map[Level]uint64),
+		Filtered: make(map[Level]uint64),
+	}
+	l.walk(func(logger *Logger) {
+		stats.add(logger.Stats())
+	})
+	return stats
+}
+
+// walk calls provided function for this logger and all its descendants,
+// parents first.
+func (l *Logger) walk(f func(*Logger)) {
+	f(l)
+	for _, child := range l.Children() {
+		child.walk(f)
+	}
+}
+
+// recordHandled updates metrics after handler processed count records.
+func (l *Logger) recordHandled(start time.Time, count int, err error) {
+	atomic.AddUint64(&l.stats.handled, uint64(count))
+	atomic.AddUint64(&l.stats.handleNanos, uint64(time.Since(start)))
+	if err != nil {
+		atomic.AddUint64(&l.stats.handlerErrors, uint64(count))
+	}
+}
+
+// AllStats returns metrics of all loggers, keyed by logger full name.
+// Root logger has empty name.
+func AllStats() map[string]Stats {
+	all := make(map[string]Stats)
+	rootLogger.walk(func(l *Logger) {
+		all[l.FullName()] = l.Stats()
+	})
+	return all
+}
+
+// PublishExpvar publishes metrics of all loggers and their sum as expvar
+// variable with provided name. Like expvar.Publish, it panics if variable
+// with same name is already published.
+func PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return map[string]interface{}{
+			"loggers": AllStats(),
+			"total":   rootLogger.TreeStats(),
+		}
+	}))
+}
+
+// WritePrometheus writes metrics of all loggers to provided writer in
+// Prometheus text exposition format.
+func WritePrometheus(w io.Writer) error {
+	all := AllStats()
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pw := &prometheusWriter{w: w}
+	pw.levelMetric("ligno_records_logged_total", "Number of records logged.", names, all,
+		func(s Stats) map[Level]uint64 { return s.Logged })
+	pw.levelMetric("ligno_records_filtered_total", "Number of records discarded because of their level.", names, all,
+		func(s Stats) map[Level]uint64 { return s.Filtered })
+	pw.metric("ligno_records_dropped_total", "Number of records discarded because queue was full.", "counter", names,
+		func(name string) string { return formatUint(all[name].Dropped) })
+	pw.metric("ligno_records_handled_total", "Number of records passed to handler.", "counter", names,
+		func(name string) string { return formatUint(all[name].Handled) })
+	pw.metric("ligno_handler_errors_total", "Number of records handler failed to process.", "counter", names,
+		func(name string) string { return formatUint(all[name].HandlerErrors) })
+	pw.metric("ligno_handle_seconds_total", "Total time spent in handler.", "counter", names,
+		func(name string) string { return fmt.Sprintf("%g", all[name].HandleTime.Seconds()) })
+	pw.metric("ligno_queue_length", "Number of records in queue.", "gauge", names,
+		func(name string) string { return strconv.Itoa(all[name].QueueLength) })
+	pw.metric("ligno_queue_capacity", "Capacity of queue.", "gauge", names,
+		func(name string) string { return strconv.Itoa(all[name].QueueCapacity) })
+	return pw.err
+}
+
+// prometheusWriter writes metrics in Prometheus text format and remembers
+// first error that occurred.
+type prometheusWriter struct {
+	w   io.Writer
+	err error
+}
+
+// printf writes formatted text, unless previous write failed.
+func (pw *prometheusWriter) printf(format string, args ...interface{}) {
+	if pw.err != nil {
+		return
+	}
+	_, pw.err = fmt.Fprintf(pw.w, format, args...)
+}
+
+// header writes HELP and TYPE lines for metric.
+func (pw *prometheusWriter) header(name, help, kind string) {
+	pw.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// metric writes metric with single value per logger.
+func (pw *prometheusWriter) metric(name, help, kind string, loggers []string, value func(string) string) {
+	pw.header(name, help, kind)
+	for _, logger := range loggers {
+		pw.printf("%s{logger=\"%s\"} %s\n", name, escapeLabel(logger), value(logger))
+	}
+}
+
+// levelMetric writes counter with value per logger and level.
+func (pw *prometheusWriter) levelMetric(name, help string, loggers []string, all map[string]Stats, values func(Stats) map[Level]uint64) {
+	pw.header(name, help, "counter")
+	for _, logger := range loggers {
+		perLevel := values(all[logger])
+		levels := make([]Level, 0, len(perLevel))
+		for level := range perLevel {
+			levels = append(levels, level)
+		}
+		sort.Slice(levels, func(i, j int) bool { return levels[i] < levels[j] })
+		for _, level := range levels {
+			pw.printf("%s{logger=\"%s\",level=\"%s\"} %d\n", name, escapeLabel(logger), escapeLabel(level.String()), perLevel[level])
+		}
+	}
+}
+
+// labelEscaper escapes label values according to Prometheus text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel escapes provided label value.
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+// formatUint formats unsigned integer in base 10.
+func formatUint(value uint64) string {
+	return strconv.FormatUint(value, 10)
+}
@@ -0,0 +1,81 @@
+package ligno
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLoggerStats(t *testing.T) {
+	l := GetLoggerOptions("stats."+randString(), LoggerOptions{
+		Level: INFO,
+		Handler: HandlerFunc(func(record Record) error {
+			if record.Level >= ERROR {
+				return errors.New("failed")
+			}
+			return nil
+		}),
+		ErrorHandler:       func(error, Record) {},
+		BufferSize:         16,
+		PreventPropagation: true,
+	})
+	child := l.SubLoggerOptions("child", LoggerOptions{Handler: NullHandler()})
+	l.Debug("filtered")
+	l.Info("info")
+	l.Info("info")
+	l.Error("error")
+	child.Warning("warning")
+	l.Wait()
+
+	stats := l.Stats()
+	if stats.Logged[INFO] != 2 || stats.Logged[ERROR] != 1 || stats.Filtered[DEBUG] != 1 {
+		t.Errorf("Unexpected level counters: logged %v, filtered %v", stats.Logged, stats.Filtered)
+	}
+	// warning is propagated from child and handled, but not counted as logged
+	if stats.Handled != 4 || stats.HandlerErrors != 1 {
+		t.Errorf("Expected 4 handled records and 1 error, got %d and %d", stats.Handled, stats.HandlerErrors)
+	}
+	if stats.QueueCapacity != 16 {
+		t.Errorf("Unexpected queue capacity: %d", stats.QueueCapacity)
+	}
+
+	tree := l.TreeStats()
+	if tree.Logged[WARNING] != 1 || tree.Handled != 5 {
+		t.Errorf("Unexpected tree stats: logged %v, handled %d", tree.Logged, tree.Handled)
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	name := "prometheus." + randString()
+	l := GetLoggerOptions(name, LoggerOptions{Handler: NullHandler(), PreventPropagation: true})
+	l.Info("message")
+	l.Wait()
+
+	buff := new(bytes.Buffer)
+	if err := WritePrometheus(buff); err != nil {
+		t.Fatal(err)
+	}
+	output := buff.String()
+	for _, expected := range []string{
+		"# TYPE ligno_records_logged_total counter\n",
+		`ligno_records_logged_total{logger="` + name + `",level="INFO"} 1` + "\n",
+		`ligno_records_handled_total{logger="` + name + `"} 1` + "\n",
+		`ligno_queue_capacity{logger="` + name + `"} 1024` + "\n",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %q in output:\n%s", expected, output)
+		}
+	}
+}
+
+func TestStatsJSON(t *testing.T) {
+	marshaled, err := json.Marshal(Stats{Logged: map[Level]uint64{INFO: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(marshaled), `"logged":{"INFO":3}`) {
+		t.Errorf("Expected levels to be marshaled by name: %s", marshaled)
+	}
+}
@@ -0,0 +1,105 @@
+package ligno
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stdLogWriter is io.Writer for standard library logger that logs every
+// message written to it with ligno logger.
+type stdLogWriter struct {
+	logger *Logger
+	level  Level
+	// prefix and flags of standard library logger, needed to strip header
+	// it adds to every message.
+	prefix string
+	flags  int
+}
+
+// Write logs message written by standard library logger. Header that
+// standard library logger adds to message is removed, but file and line,
+// if present in header, are kept in record.
+func (sw *stdLogWriter) Write(p []byte) (int, error) {
+	message, file, line := stripStdLogHeader(string(p), sw.prefix, sw.flags)
+	sw.logger.log(0, Record{
+		Time:       time.Now().UTC(),
+		Level:      sw.level,
+		Message:    strings.TrimSuffix(message, "\n"),
+		Logger:     sw.logger,
+		LoggerName: sw.logger.fullName,
+		File:       file,
+		Line:       line,
+	})
+	return len(p), nil
+}
+
+// stripStdLogHeader removes prefix, date, time and file that standard
+// library logger with provided prefix and flags adds to message. File and
+// line are returned if they were in header.
+func stripStdLogHeader(message, prefix string, flags int) (string, string, int) {
+	if flags&log.Lmsgprefix == 0 {
+		message = strings.TrimPrefix(message, prefix)
+	}
+	if flags&log.Ldate != 0 {
+		message = skipBytes(message, len("2006/01/02 "))
+	}
+	if flags&(log.Ltime|log.Lmicroseconds) != 0 {
+		length := len("15:04:05 ")
+		if flags&log.Lmicroseconds != 0 {
+			length += len(".000000")
+		}
+		message = skipBytes(message, length)
+	}
+	var file string
+	var line int
+	if flags&(log.Lshortfile|log.Llongfile) != 0 {
+		if i := strings.Index(message, ": "); i >= 0 {
+			location := message[:i]
+			message = message[i+2:]
+			if j := strings.LastIndexByte(location, ':'); j >= 0 {
+				file = location[:j]
+				line, _ = strconv.Atoi(location[j+1:])
+			}
+		}
+	}
+	if flags&log.Lmsgprefix != 0 {
+		message = strings.TrimPrefix(message, prefix)
+	}
+	return message, file, line
+}
+
+// skipBytes returns provided string without first n bytes.
+func skipBytes(s string, n int) string {
+	if len(s) < n {
+		return ""
+	}
+	return s[n:]
+}
+
+// RedirectStdLog makes standard library logger (used by log.Printf and
+// similar functions) write all messages to provided logger with provided
+// level. Prefix and flags of standard library logger are stripped from
+// messages, so they should be set before calling this function. Returned
+// function restores previous output of standard library logger.
+func RedirectStdLog(l *Logger, level Level) (restore func()) {
+	previous := log.Writer()
+	log.SetOutput(&stdLogWriter{
+		logger: l,
+		level:  level,
+		prefix: log.Prefix(),
+		flags:  log.Flags(),
+	})
+	return func() {
+		log.SetOutput(previous)
+	}
+}
+
+// StdLogger returns standard library logger that writes all messages to
+// this logger with provided level. It is useful for libraries that accept
+// *log.Logger, like http.Server. Prefix and flags of returned logger should
+// not be changed, since they are not stripped from messages.
+func (l *Logger) StdLogger(level Level) *log.Logger {
+	return log.New(&stdLogWriter{logger: l, level: level}, "", 0)
+}
@@ -0,0 +1,76 @@
+package ligno
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// stdLogFormat formats record as level, file, line and message.
+func stdLogFormat() Formatter {
+	return FormatterFunc(func(record Record) []byte {
+		return []byte(fmt.Sprintf("%s %s:%d %s", record.Level, filepath.Base(record.File), record.Line, record.Message))
+	})
+}
+
+func TestRedirectStdLog(t *testing.T) {
+	memory := MemoryHandler(stdLogFormat())
+	l := GetLoggerOptions("stdlog."+randString(), LoggerOptions{
+		Handler:            memory,
+		PreventPropagation: true,
+	})
+	flags, prefix := log.Flags(), log.Prefix()
+	defer func() {
+		log.SetFlags(flags)
+		log.SetPrefix(prefix)
+	}()
+	previous := log.Writer()
+
+	var line int
+	for _, flags := range []int{0, log.LstdFlags | log.Lmicroseconds | log.Lshortfile, log.Ldate | log.Llongfile | log.Lmsgprefix} {
+		log.SetFlags(flags)
+		log.SetPrefix("app: ")
+		restore := RedirectStdLog(l, WARNING)
+		log.Printf("message %d", flags)
+		_, _, line, _ = runtime.Caller(0)
+		restore()
+	}
+	if log.Writer() != previous {
+		t.Error("Expected output of standard library logger to be restored.")
+	}
+	l.Wait()
+
+	expected := []string{
+		"WARNING .:0 message 0",
+		fmt.Sprintf("WARNING stdlog_test.go:%d message %d", line-1, log.LstdFlags|log.Lmicroseconds|log.Lshortfile),
+		fmt.Sprintf("WARNING stdlog_test.go:%d message %d", line-1, log.Ldate|log.Llongfile|log.Lmsgprefix),
+	}
+	messages := memory.Messages()
+	if len(messages) != len(expected) {
+		t.Fatalf("Expected %d messages, got %v", len(expected), messages)
+	}
+	for i := range expected {
+		if messages[i] != expected[i] {
+			t.Errorf("Expected message %q, got %q", expected[i], messages[i])
+		}
+	}
+	l.StopAndWait()
+}
+
+func TestStdLogger(t *testing.T) {
+	memory := MemoryHandler(messageFormat())
+	l := GetLoggerOptions("stdlog."+randString(), LoggerOptions{
+		Handler:            memory,
+		Level:              INFO,
+		PreventPropagation: true,
+	})
+	l.StdLogger(ERROR).Println("failed")
+	l.StdLogger(DEBUG).Println("filtered")
+	l.Wait()
+	if messages := memory.Messages(); len(messages) != 1 || messages[0] != "failed\n" {
+		t.Errorf("Expected single message, got %q", messages)
+	}
+	l.StopAndWait()
+}
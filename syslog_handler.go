@@ -0,0 +1,378 @@
+package ligno
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"log/syslog"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyslogFormat is format of messages that syslog handler sends.
+type SyslogFormat uint8
+
+const (
+	// RFC5424 is format defined in RFC 5424, with record context sent as
+	// structured data.
+	RFC5424 SyslogFormat = iota
+	// RFC3164 is legacy BSD syslog format, with record context appended to
+	// message as key=value pairs.
+	RFC3164
+)
+
+// DefaultSyslogTimeout is timeout for connecting and writing to syslog
+// server if it is not set in options.
+const DefaultSyslogTimeout = 5 * time.Second
+
+// DefaultStructuredDataID is SD-ID under which record context is sent in
+// RFC 5424 messages if it is not set in options.
+const DefaultStructuredDataID = "ctx@32473"
+
+// localSyslogPaths are paths of unix sockets on which local syslog server
+// usually listens.
+var localSyslogPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// SyslogOptions holds configuration of syslog handler.
+type SyslogOptions struct {
+	// Network is one of "unix", "unixgram", "udp", "tcp" and "tcp+tls".
+	// If it is empty, local syslog server is used. Messages in RFC5424
+	// format over tcp and tcp+tls are framed with octet counting, while
+	// other messages over stream networks are terminated by newline.
+	Network string
+	// Address is address of syslog server, or path of unix socket.
+	Address string
+	// TLSConfig is configuration of TLS connection for tcp+tls network.
+	TLSConfig *tls.Config
+	// Timeout is timeout for connecting and writing. If not set,
+	// DefaultSyslogTimeout is used.
+	Timeout time.Duration
+	// Format is format of messages. Default is RFC5424.
+	Format SyslogFormat
+	// Facility is syslog facility of messages. Default is LOG_USER.
+	Facility syslog.Priority
+	// Severity maps record level to syslog severity. If not set,
+	// SyslogSeverity is used.
+	Severity func(Level) syslog.Priority
+	// Hostname is name of host sent in messages. If not set, name reported
+	// by operating system is used.
+	Hostname string
+	// AppName is name of application (tag in RFC 3164) sent in messages. If
+	// not set, name of executable is used.
+	AppName string
+	// StructuredDataID is SD-ID under which record context is sent in
+	// RFC 5424 messages. If not set, DefaultStructuredDataID is used.
+	StructuredDataID string
+	// Formatter formats message part of syslog message. If not set, record
+	// message is used, followed by context as key=value pairs in RFC 3164
+	// format.
+	Formatter Formatter
+}
+
+// SyslogSeverity maps level to syslog severity by ranges, so custom levels
+// get severity of nearest lower builtin level.
+func SyslogSeverity(level Level) syslog.Priority {
+	switch {
+	case level >= CRITICAL:
+		return syslog.LOG_CRIT
+	case level >= ERROR:
+		return syslog.LOG_ERR
+	case level >= WARNING:
+		return syslog.LOG_WARNING
+	case level >= INFO:
+		return syslog.LOG_INFO
+	default:
+		return syslog.LOG_DEBUG
+	}
+}
+
+// syslogNetHandler writes syslog messages to syslog server.
+type syslogNetHandler struct {
+	mu      sync.Mutex
+	options SyslogOptions
+	pid     int
+	conn    net.Conn
+	framing syslogFraming
+	closed  bool
+}
+
+// syslogFraming defines how messages are separated in stream of bytes.
+type syslogFraming uint8
+
+const (
+	// noFraming is used for datagram networks, where every message is
+	// sent in its own datagram.
+	noFraming syslogFraming = iota
+	// newlineFraming terminates every message with newline.
+	newlineFraming
+	// octetCountingFraming prefixes every message with its length, as
+	// defined in RFC 6587.
+	octetCountingFraming
+)
+
+// SyslogHandlerOptions creates handler that sends records to syslog server
+// over unix socket, UDP, TCP or TCP with TLS. Unlike SyslogHandler, it
+// formats messages itself, so it works with remote servers too. Connection
+// is established when first record is handled. If writing fails, handler
+// reconnects and tries once more. If that fails too, error is returned and
+// handler reconnects on next record.
+func SyslogHandlerOptions(options SyslogOptions) Handler {
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultSyslogTimeout
+	}
+	if options.Facility == 0 {
+		options.Facility = syslog.LOG_USER
+	}
+	if options.Severity == nil {
+		options.Severity = SyslogSeverity
+	}
+	if options.Hostname == "" {
+		options.Hostname, _ = os.Hostname()
+	}
+	if options.AppName == "" {
+		options.AppName = filepath.Base(os.Args[0])
+	}
+	if options.StructuredDataID == "" {
+		options.StructuredDataID = DefaultStructuredDataID
+	}
+	return &syslogNetHandler{
+		options: options,
+		pid:     os.Getpid(),
+	}
+}
+
+// Handle sends record to syslog server.
+func (sh *syslogNetHandler) Handle(record Record) error {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if sh.closed {
+		return errHandlerClosed
+	}
+	connected := sh.conn != nil
+	err := sh.write(record)
+	if err != nil && connected {
+		// connection might have been broken by server, so try once more
+		// with new one
+		sh.disconnect()
+		err = sh.write(record)
+	}
+	if err != nil {
+		sh.disconnect()
+	}
+	return err
+}
+
+// write connects to server if needed and writes record to it. Caller must
+// hold lock.
+func (sh *syslogNetHandler) write(record Record) error {
+	if sh.conn == nil {
+		if err := sh.connect(); err != nil {
+			return err
+		}
+	}
+	message := sh.message(record)
+	switch sh.framing {
+	case newlineFraming:
+		message = append(message, '\n')
+	case octetCountingFraming:
+		message = append([]byte(strconv.Itoa(len(message))+" "), message...)
+	}
+	sh.conn.SetWriteDeadline(time.Now().Add(sh.options.Timeout))
+	_, err := sh.conn.Write(message)
+	return err
+}
+
+// connect establishes connection with syslog server. Caller must hold lock.
+func (sh *syslogNetHandler) connect() error {
+	var conn net.Conn
+	var err error
+	switch sh.options.Network {
+	case "":
+		conn, err = dialLocalSyslog(sh.options.Timeout)
+	case "tcp+tls":
+		// assigned through local variable, since failed dial returns typed
+		// nil, which would not be equal to nil connection
+		var tlsConn *tls.Conn
+		dialer := &net.Dialer{Timeout: sh.options.Timeout}
+		if tlsConn, err = tls.DialWithDialer(dialer, "tcp", sh.options.Address, sh.options.TLSConfig); err == nil {
+			conn = tlsConn
+		}
+	default:
+		conn, err = net.DialTimeout(sh.options.Network, sh.options.Address, sh.options.Timeout)
+	}
+	if err != nil {
+		return err
+	}
+	sh.conn = conn
+	switch network := conn.RemoteAddr().Network(); {
+	case network == "udp" || network == "unixgram":
+		sh.framing = noFraming
+	case network == "tcp" && sh.options.Format == RFC5424:
+		sh.framing = octetCountingFraming
+	default:
+		sh.framing = newlineFraming
+	}
+	return nil
+}
+
+// dialLocalSyslog connects to local syslog server.
+func dialLocalSyslog(timeout time.Duration) (net.Conn, error) {
+	for _, network := range []string{"unixgram", "unix"} {
+		for _, path := range localSyslogPaths {
+			if conn, err := net.DialTimeout(network, path, timeout); err == nil {
+				return conn, nil
+			}
+		}
+	}
+	return nil, errors.New("unable to connect to local syslog server")
+}
+
+// disconnect closes connection to server. Caller must hold lock.
+func (sh *syslogNetHandler) disconnect() {
+	if sh.conn != nil {
+		sh.conn.Close()
+		sh.conn = nil
+	}
+}
+
+// message formats record as syslog message.
+func (sh *syslogNetHandler) message(record Record) []byte {
+	buff := new(bytes.Buffer)
+	priority := sh.options.Facility | sh.options.Severity(record.Level)
+	buff.WriteByte('<')
+	buff.WriteString(strconv.Itoa(int(priority)))
+	buff.WriteByte('>')
+	if sh.options.Format == RFC3164 {
+		buff.WriteString(record.Time.Local().Format(time.Stamp))
+		buff.WriteByte(' ')
+		buff.WriteString(syslogHeaderField(sh.options.Hostname, 255))
+		buff.WriteByte(' ')
+		buff.WriteString(syslogHeaderField(sh.options.AppName, 32))
+		buff.WriteByte('[')
+		buff.WriteString(strconv.Itoa(sh.pid))
+		buff.WriteString("]: ")
+		buff.Write(sh.text(record, true))
+		return buff.Bytes()
+	}
+
+	buff.WriteString("1 ")
+	buff.WriteString(record.Time.Format("2006-01-02T15:04:05.000000Z07:00"))
+	buff.WriteByte(' ')
+	buff.WriteString(syslogHeaderField(sh.options.Hostname, 255))
+	buff.WriteByte(' ')
+	buff.WriteString(syslogHeaderField(sh.options.AppName, 48))
+	buff.WriteByte(' ')
+	buff.WriteString(strconv.Itoa(sh.pid))
+	buff.WriteByte(' ')
+	buff.WriteString(syslogHeaderField(record.LoggerName, 32))
+	buff.WriteByte(' ')
+	sh.writeStructuredData(buff, record.Context)
+	if text := sh.text(record, false); len(text) > 0 {
+		buff.WriteByte(' ')
+		buff.Write(text)
+	}
+	return buff.Bytes()
+}
+
+// text returns message part of syslog message. If formatter is not set,
+// record message is used, followed by context if includeContext is true.
+func (sh *syslogNetHandler) text(record Record, includeContext bool) []byte {
+	if sh.options.Formatter != nil {
+		return bytes.TrimRight(sh.options.Formatter.Format(record), "\n")
+	}
+	buff := new(bytes.Buffer)
+	buff.WriteString(record.Message)
+	if includeContext {
+		for _, key := range sortedKeys(record.Context) {
+			buff.WriteByte(' ')
+			writeLogfmtKey(buff, key)
+			buff.WriteByte('=')
+			writeLogfmtValue(buff, formatValue(record.Context[key]))
+		}
+	}
+	return buff.Bytes()
+}
+
+// writeStructuredData writes context as single SD-ELEMENT, or NILVALUE if
+// context is empty.
+func (sh *syslogNetHandler) writeStructuredData(buff *bytes.Buffer, ctx Ctx) {
+	if len(ctx) == 0 {
+		buff.WriteByte('-')
+		return
+	}
+	buff.WriteByte('[')
+	buff.WriteString(syslogSDName(sh.options.StructuredDataID))
+	for _, key := range sortedKeys(ctx) {
+		buff.WriteByte(' ')
+		buff.WriteString(syslogSDName(key))
+		buff.WriteString(`="`)
+		buff.WriteString(sdValueEscaper.Replace(formatValue(ctx[key])))
+		buff.WriteByte('"')
+	}
+	buff.WriteByte(']')
+}
+
+// sdValueEscaper escapes characters that are not allowed in PARAM-VALUE.
+var sdValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// syslogHeaderField returns value usable as RFC 5424 header field: only
+// printable ASCII characters, at most maxLength of them, or NILVALUE if
+// value is empty.
+func syslogHeaderField(value string, maxLength int) string {
+	field := strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, value)
+	if len(field) > maxLength {
+		field = field[:maxLength]
+	}
+	if field == "" {
+		return "-"
+	}
+	return field
+}
+
+// syslogSDName returns value usable as SD-NAME: printable ASCII characters
+// except '=', ' ', ']' and '"', at most 32 of them.
+func syslogSDName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, name)
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+// sortedKeys returns keys of context, sorted.
+func sortedKeys(ctx Ctx) []string {
+	keys := make([]string, 0, len(ctx))
+	for key := range ctx {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Close closes connection with syslog server. Records handled after Close
+// are not sent.
+func (sh *syslogNetHandler) Close() {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	sh.closed = true
+	sh.disconnect()
+}
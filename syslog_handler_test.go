@@ -0,0 +1,238 @@
+package ligno
+
+import (
+	"bufio"
+	"fmt"
+	"log/syslog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogSeverity(t *testing.T) {
+	tests := map[Level]syslog.Priority{
+		NOTSET:       syslog.LOG_DEBUG,
+		DEBUG:        syslog.LOG_DEBUG,
+		INFO:         syslog.LOG_INFO,
+		WARNING + 5:  syslog.LOG_WARNING,
+		ERROR:        syslog.LOG_ERR,
+		CRITICAL + 5: syslog.LOG_CRIT,
+	}
+	for level, expected := range tests {
+		if severity := SyslogSeverity(level); severity != expected {
+			t.Errorf("Expected severity %d for level %d, got %d", expected, level, severity)
+		}
+	}
+}
+
+func TestSyslogHandlerUDP(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	h := SyslogHandlerOptions(SyslogOptions{
+		Network:  "udp",
+		Address:  server.LocalAddr().String(),
+		Hostname: "host",
+		AppName:  "app",
+	})
+	defer h.(HandlerCloser).Close()
+
+	err = h.Handle(Record{
+		Time:       time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Level:      WARNING,
+		Message:    "message",
+		LoggerName: "app.db",
+		Context:    Ctx{"b": `x"]`, "a": 1},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	buff := make([]byte, 1024)
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := server.ReadFrom(buff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := fmt.Sprintf(`<12>1 2020-01-02T03:04:05.000000Z host app %d app.db [ctx@32473 a="1" b="x\"\]"] message`, os.Getpid())
+	if got := string(buff[:n]); got != expected {
+		t.Errorf("Expected message:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestSyslogHandlerUnixRFC3164(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "syslog.sock")
+	server, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Skipf("Unix datagram sockets are not supported: %v", err)
+	}
+	defer server.Close()
+	h := SyslogHandlerOptions(SyslogOptions{
+		Network:  "unixgram",
+		Address:  path,
+		Format:   RFC3164,
+		Facility: syslog.LOG_LOCAL0,
+		Hostname: "host",
+		AppName:  "app",
+	})
+	defer h.(HandlerCloser).Close()
+
+	if err := h.Handle(Record{Time: time.Now(), Level: INFO, Message: "message", Context: Ctx{"a": 1}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	buff := make([]byte, 1024)
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := server.ReadFrom(buff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(buff[:n])
+	suffix := fmt.Sprintf(" host app[%d]: message a=1", os.Getpid())
+	if !strings.HasPrefix(got, "<134>") || !strings.HasSuffix(got, suffix) {
+		t.Errorf("Unexpected message: %s", got)
+	}
+}
+
+// readOctetCounted reads single octet counted syslog message.
+func readOctetCounted(r *bufio.Reader) (string, error) {
+	length, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(length))
+	if err != nil {
+		return "", err
+	}
+	message := make([]byte, n)
+	_, err = r.Read(message)
+	return string(message), err
+}
+
+func TestSyslogHandlerTCPReconnect(t *testing.T) {
+	server, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	messages := make(chan string, 100)
+	go func() {
+		for connection := 1; ; connection++ {
+			conn, err := server.Accept()
+			if err != nil {
+				return
+			}
+			reader := bufio.NewReader(conn)
+			for {
+				message, err := readOctetCounted(reader)
+				if err != nil {
+					break
+				}
+				messages <- fmt.Sprintf("%d %s", connection, message)
+				if connection == 1 {
+					// drop first connection after first message
+					break
+				}
+			}
+			conn.Close()
+		}
+	}()
+
+	h := SyslogHandlerOptions(SyslogOptions{
+		Network:  "tcp",
+		Address:  server.Addr().String(),
+		Hostname: "host",
+		AppName:  "app",
+	})
+	defer h.(HandlerCloser).Close()
+	h.Handle(Record{Time: time.Now(), Level: INFO, Message: "first"})
+	if got := <-messages; !strings.HasPrefix(got, "1 <14>1 ") || !strings.HasSuffix(got, " - first") {
+		t.Fatalf("Unexpected first message: %s", got)
+	}
+
+	// writes to dropped connection might succeed until failure is detected,
+	// so keep writing until message arrives through new connection
+	deadline := time.After(5 * time.Second)
+	for {
+		h.Handle(Record{Time: time.Now(), Level: INFO, Message: "again"})
+		select {
+		case got := <-messages:
+			if !strings.HasPrefix(got, "2 ") {
+				t.Fatalf("Expected message over new connection, got: %s", got)
+			}
+			return
+		case <-deadline:
+			t.Fatal("Handler did not reconnect.")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestSyslogHandlerNewlineFraming(t *testing.T) {
+	unixPath := filepath.Join(t.TempDir(), "syslog.sock")
+	for _, tc := range []struct {
+		network, address string
+		format           SyslogFormat
+	}{
+		{"tcp", "127.0.0.1:0", RFC3164},
+		{"unix", unixPath, RFC5424},
+	} {
+		server, err := net.Listen(tc.network, tc.address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := SyslogHandlerOptions(SyslogOptions{
+			Network:  tc.network,
+			Address:  server.Addr().String(),
+			Format:   tc.format,
+			Hostname: "host",
+			AppName:  "app",
+		})
+		h.Handle(Record{Time: time.Now(), Level: INFO, Message: "first"})
+		h.Handle(Record{Time: time.Now(), Level: INFO, Message: "second"})
+
+		conn, err := server.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		reader := bufio.NewReader(conn)
+		for _, message := range []string{"first", "second"} {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("%s: %v", tc.network, err)
+			}
+			if !strings.HasPrefix(line, "<14>") || !strings.HasSuffix(line, message+"\n") {
+				t.Errorf("%s: unexpected message: %q", tc.network, line)
+			}
+		}
+		conn.Close()
+		h.(HandlerCloser).Close()
+		server.Close()
+	}
+}
+
+func TestSyslogHandlerTLSConnectionRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	h := SyslogHandlerOptions(SyslogOptions{
+		Network: "tcp+tls",
+		Address: address,
+		Timeout: time.Second,
+	})
+	defer h.(HandlerCloser).Close()
+	for i := 0; i < 2; i++ {
+		if err := h.Handle(Record{Time: time.Now(), Message: "message"}); err == nil {
+			t.Error("Expected error when connection is refused.")
+		}
+	}
+}
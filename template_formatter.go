@@ -0,0 +1,263 @@
+package ligno
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// segmentWriter writes part of formatted record to buffer.
+type segmentWriter func(buff *bytes.Buffer, record Record)
+
+// alignment defines how value is padded to width.
+type alignment byte
+
+const (
+	alignLeft   alignment = '<'
+	alignRight  alignment = '>'
+	alignCenter alignment = '^'
+)
+
+// TemplateFormat returns formatter that formats records according to
+// provided pattern. Pattern is text with placeholders in curly braces,
+// for example:
+//
+//	"{time:2006-01-02T15:04:05} {level:<8} {logger} {file}:{line} {message} {ctx}"
+//
+// Supported placeholders are:
+//
+//	{time:LAYOUT}  record time formatted with layout (DefaultTimeFormat if omitted)
+//	{level}        level name
+//	{logger}       full name of logger that created record
+//	{file}         file where record was created
+//	{line}         line where record was created
+//	{message}      record message
+//	{ctx}          all context keys, sorted, in key=value format
+//	{ctx.KEY}      value of single context key
+//
+// All placeholders except time accept width and alignment after colon,
+// like {level:<8} (left aligned), {level:>8} (right aligned) or
+// {level:^8} (centered). Literal braces are written as {{ and }}.
+// New line is appended to every formatted record.
+// Pattern is compiled once and TemplateFormat panics if it is invalid.
+// Use CompileTemplateFormat to get error instead.
+func TemplateFormat(pattern string) Formatter {
+	return ThemedTemplateFormat(nil, pattern)
+}
+
+// ThemedTemplateFormat is same as TemplateFormat, but time and level
+// are colored using provided theme.
+func ThemedTemplateFormat(theme Theme, pattern string) Formatter {
+	formatter, err := CompileTemplateFormat(pattern, theme)
+	if err != nil {
+		panic(err)
+	}
+	return formatter
+}
+
+// CompileTemplateFormat compiles provided pattern (see TemplateFormat) to
+// formatter. If theme is not nil, time and level are colored using it.
+func CompileTemplateFormat(pattern string, theme Theme) (Formatter, error) {
+	var writers []segmentWriter
+	literal := new(bytes.Buffer)
+	flushLiteral := func() {
+		if literal.Len() > 0 {
+			writers = append(writers, literalWriter(literal.String()))
+			literal.Reset()
+		}
+	}
+	for i := 0; i < len(pattern); {
+		c := pattern[i]
+		switch {
+		case c == '{' && strings.HasPrefix(pattern[i:], "{{"):
+			literal.WriteByte('{')
+			i += 2
+		case c == '}' && strings.HasPrefix(pattern[i:], "}}"):
+			literal.WriteByte('}')
+			i += 2
+		case c == '}':
+			return nil, fmt.Errorf("unexpected '}' at position %d in pattern %q", i, pattern)
+		case c == '{':
+			end := strings.IndexByte(pattern[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed '{' at position %d in pattern %q", i, pattern)
+			}
+			writer, err := placeholderWriter(pattern[i+1:i+end], theme)
+			if err != nil {
+				return nil, err
+			}
+			flushLiteral()
+			writers = append(writers, writer)
+			i += end + 1
+		default:
+			literal.WriteByte(c)
+			i++
+		}
+	}
+	flushLiteral()
+
+	return FormatterFunc(func(record Record) []byte {
+		buff := buffPool.Get()
+		defer buffPool.Put(buff)
+		for _, w := range writers {
+			w(buff, record)
+		}
+		buff.WriteRune('\n')
+		return buffPool.bytes(buff)
+	}), nil
+}
+
+// literalWriter returns writer that writes provided text.
+func literalWriter(text string) segmentWriter {
+	return func(buff *bytes.Buffer, record Record) {
+		buff.WriteString(text)
+	}
+}
+
+// placeholderWriter returns writer for placeholder with provided content
+// (text between curly braces).
+func placeholderWriter(placeholder string, theme Theme) (segmentWriter, error) {
+	name, spec := placeholder, ""
+	if idx := strings.IndexByte(placeholder, ':'); idx >= 0 {
+		name, spec = placeholder[:idx], placeholder[idx+1:]
+	}
+
+	if name == "time" {
+		layout := spec
+		if layout == "" {
+			layout = DefaultTimeFormat
+		}
+		return func(buff *bytes.Buffer, record Record) {
+			text := record.Time.Format(layout)
+			if theme != nil {
+				text = theme.Time("%s", text)
+			}
+			buff.WriteString(text)
+		}, nil
+	}
+
+	var value func(Record) string
+	var color func(Record) func(string, ...interface{}) string
+	switch {
+	case name == "level":
+		value = func(record Record) string { return record.Level.String() }
+		if theme != nil {
+			color = func(record Record) func(string, ...interface{}) string {
+				return theme.ForLevel(record.Level)
+			}
+		}
+	case name == "logger":
+		value = func(record Record) string { return record.LoggerName }
+	case name == "file":
+		value = func(record Record) string { return record.File }
+	case name == "line":
+		value = func(record Record) string {
+			if record.Line <= 0 {
+				return ""
+			}
+			return strconv.Itoa(record.Line)
+		}
+	case name == "message":
+		value = func(record Record) string { return record.Message }
+	case name == "ctx":
+		value = formatContext
+	case strings.HasPrefix(name, "ctx."):
+		key := strings.TrimPrefix(name, "ctx.")
+		value = func(record Record) string {
+			v, ok := record.Context[key]
+			if !ok {
+				return ""
+			}
+			return formatValue(v)
+		}
+	default:
+		return nil, fmt.Errorf("unknown placeholder {%s}", placeholder)
+	}
+
+	align, width, err := parseAlignment(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid placeholder {%s}: %v", placeholder, err)
+	}
+	return func(buff *bytes.Buffer, record Record) {
+		text := value(record)
+		padding := width - utf8.RuneCountInString(text)
+		if color != nil {
+			text = color(record)("%s", text)
+		}
+		writePadded(buff, text, padding, align)
+	}, nil
+}
+
+// parseAlignment parses spec in format [<>^]width. Empty spec means no padding.
+func parseAlignment(spec string) (alignment, int, error) {
+	if spec == "" {
+		return alignLeft, 0, nil
+	}
+	align := alignLeft
+	switch alignment(spec[0]) {
+	case alignLeft, alignRight, alignCenter:
+		align = alignment(spec[0])
+		spec = spec[1:]
+	}
+	width, err := strconv.Atoi(spec)
+	if err != nil || width < 0 {
+		return alignLeft, 0, fmt.Errorf("invalid width %q", spec)
+	}
+	return align, width, nil
+}
+
+// writePadded writes text to buffer, adding provided number of spaces
+// according to alignment.
+func writePadded(buff *bytes.Buffer, text string, padding int, align alignment) {
+	if padding <= 0 {
+		buff.WriteString(text)
+		return
+	}
+	var before, after int
+	switch align {
+	case alignRight:
+		before = padding
+	case alignCenter:
+		before = padding / 2
+		after = padding - before
+	default:
+		after = padding
+	}
+	writeSpaces(buff, before)
+	buff.WriteString(text)
+	writeSpaces(buff, after)
+}
+
+// writeSpaces writes n spaces to buffer.
+func writeSpaces(buff *bytes.Buffer, n int) {
+	for i := 0; i < n; i++ {
+		buff.WriteByte(' ')
+	}
+}
+
+// formatContext returns all context keys of record, sorted and in
+// key=value format, separated by spaces.
+func formatContext(record Record) string {
+	if len(record.Context) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(record.Context))
+	for k := range record.Context {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	buff := buffPool.Get()
+	defer buffPool.Put(buff)
+	for i, k := range keys {
+		if i > 0 {
+			buff.WriteRune(' ')
+		}
+		writeLogfmtKey(buff, k)
+		buff.WriteRune('=')
+		writeLogfmtValue(buff, formatValue(record.Context[k]))
+	}
+	return buff.String()
+}